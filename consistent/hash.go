@@ -2,6 +2,8 @@ package consistent
 
 import (
 	"hash/crc32"
+	"hash/fnv"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -9,51 +11,289 @@ import (
 // Hash maps bytes to uint32
 type Hash func(data []byte) uint32
 
+// Hash64 maps bytes to uint64
+type Hash64 func(data []byte) uint64
+
 var defaultHash = crc32.ChecksumIEEE
 
+// FNV64aMixed is the 64-bit FNV-1a hash with its bits mixed at last,
+// so it doesn't match plain FNV-1a. It spreads thousands of virtual keys
+// better than crc32, and the mixing keeps keys differing only in the
+// last bytes, e.g. key1 and key2, from landing close on the ring.
+func FNV64aMixed(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return mix64(h.Sum64())
+}
+
+// vnode is a virtual key of a real key on the ring
+type vnode struct {
+	hash uint64
+	node string
+}
+
 // Map contains all hashed keys
 type Map struct {
-	hash     Hash
-	replicas int            // how many replicas (virtual nodes)
-	keys     []int          // sorted, store all keys
-	dict     map[int]string // virtual key to real key
+	hash     Hash64
+	space    float64 // size of the hash space
+	replicas int     // how many replicas (virtual nodes) of weight 1
+	// sorted by hash then node, so real keys colliding
+	// on a hash are kept both, in a fixed order
+	ring    []vnode
+	weights map[string]int    // real key to its weight
+	labels  map[string]Labels // real key to its failure domain, if labeled
+}
+
+// Labels tell the failure domain of a node, replicas are spread
+// over zones first, then over racks in a zone
+type Labels struct {
+	Zone string
+	Rack string
 }
 
 // New construct a consistent hash, fn can be nil
 func New(replicas int, fn Hash) *Map {
-	m := &Map{
-		hash:     fn,
-		replicas: replicas,
-		dict:     make(map[int]string),
+	if fn == nil {
+		fn = defaultHash
 	}
-	if m.hash == nil {
-		m.hash = defaultHash
+	m := newMap(replicas, func(data []byte) uint64 {
+		return uint64(fn(data))
+	})
+	m.space = 1 << 32
+	return m
+}
+
+// New64 is New with a 64-bit hash, FNV64aMixed if fn is nil
+func New64(replicas int, fn Hash64) *Map {
+	if fn == nil {
+		fn = FNV64aMixed
 	}
+	m := newMap(replicas, fn)
+	m.space = 1 << 64
 	return m
 }
 
+func newMap(replicas int, fn Hash64) *Map {
+	return &Map{
+		hash:     fn,
+		replicas: replicas,
+		weights:  make(map[string]int),
+		labels:   make(map[string]Labels),
+	}
+}
+
 // Add given keys.
-// Each key has replicas virtual key
+// Each key has replicas virtual key, keys already in the map are skipped
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			virtualKey := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, virtualKey)
-			m.dict[virtualKey] = key
+		if !m.Has(key) {
+			m.add(key, 1)
 		}
 	}
-	sort.Ints(m.keys)
+	m.sort()
+}
+
+// AddWeighted adds key with weight times replicas virtual keys,
+// so its share of the keyspace scales with weight, e.g. with
+// the capacity of the node. A key in the map gets the new weight.
+func (m *Map) AddWeighted(key string, weight int) {
+	checkWeight(weight)
+	if w, ok := m.weights[key]; ok {
+		if w == weight {
+			return
+		}
+		m.Remove(key)
+	}
+	m.add(key, weight)
+	m.sort()
+}
+
+// add adds the virtual keys of key, without sorting
+func (m *Map) add(key string, weight int) {
+	m.weights[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		m.ring = append(m.ring, vnode{hash: m.hash([]byte(strconv.Itoa(i) + key)), node: key})
+	}
+}
+
+// sort sorts the ring, a hash collision is broken by the real keys
+func (m *Map) sort() {
+	sort.Slice(m.ring, func(i, j int) bool {
+		if m.ring[i].hash != m.ring[j].hash {
+			return m.ring[i].hash < m.ring[j].hash
+		}
+		return m.ring[i].node < m.ring[j].node
+	})
+}
+
+// Remove removes given keys and their virtual keys,
+// the other keys keep their places
+func (m *Map) Remove(keys ...string) {
+	removed := false
+	for _, key := range keys {
+		if m.Has(key) {
+			delete(m.weights, key)
+			removed = true
+		}
+	}
+	if !removed {
+		return
+	}
+
+	// filter in place, ring stays sorted
+	n := 0
+	for _, v := range m.ring {
+		if m.Has(v.node) {
+			m.ring[n] = v
+			n++
+		}
+	}
+	m.ring = m.ring[:n]
+}
+
+// Has tells whether key is in the map
+func (m *Map) Has(key string) bool {
+	_, ok := m.weights[key]
+	return ok
+}
+
+// Nodes returns the keys in the map, sorted
+func (m *Map) Nodes() []string {
+	return sortedNodes(m.weights)
+}
+
+// SetLabels labels key with its failure domain, zero labels
+// unlabel it. Labels are kept when key is removed.
+func (m *Map) SetLabels(key string, labels Labels) {
+	if labels == (Labels{}) {
+		delete(m.labels, key)
+		return
+	}
+	m.labels[key] = labels
+}
+
+// Labels returns the labels of key
+func (m *Map) Labels(key string) Labels {
+	return m.labels[key]
+}
+
+// Shares returns the fraction of the hash space owned by each key,
+// which is the expected share of the keyspace it serves
+func (m *Map) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(m.weights))
+	for node := range m.weights {
+		shares[node] = 0
+	}
+	if len(m.ring) == 0 {
+		return shares
+	}
+
+	// a virtual key owns the arc from the previous one, the first
+	// one owns the arc wrapping around from the last one
+	prev := float64(m.ring[len(m.ring)-1].hash) - m.space
+	for _, v := range m.ring {
+		shares[v.node] += (float64(v.hash) - prev) / m.space
+		prev = float64(v.hash)
+	}
+	return shares
+}
+
+// search returns the index of the first virtual key at or after k
+func (m *Map) search(k string) int {
+	hash := m.hash([]byte(k))
+	idx := sort.Search(len(m.ring), func(i int) bool {
+		return m.ring[i].hash >= hash
+	})
+	return idx % len(m.ring)
 }
 
 // Locate gets the closest node's key, return "" if not found
 func (m *Map) Locate(k string) string {
-	if len(k) == 0 {
+	if len(k) == 0 || len(m.ring) == 0 {
 		return ""
 	}
-	hash := int(m.hash([]byte(k)))
+	return m.ring[m.search(k)].node
+}
 
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
-	})
-	return m.dict[m.keys[idx%len(m.keys)]]
+// LocateN returns up to n distinct nodes of k in ring order,
+// skipping the other virtual keys of nodes already taken. With
+// labels, nodes in new zones are taken first, then nodes in new
+// racks, then the rest, each in ring order. Locate's is the first.
+func (m *Map) LocateN(k string, n int) []string {
+	if len(k) == 0 || len(m.ring) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+	limit := n
+	if len(m.labels) > 0 {
+		limit = len(m.weights) // domains are picked among all
+	}
+	idx := m.search(k)
+	nodes := make([]string, 0, limit)
+	for i := 0; i < len(m.ring) && len(nodes) < limit; i++ {
+		if node := m.ring[(idx+i)%len(m.ring)].node; !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(m.labels) == 0 {
+		return nodes
+	}
+	return m.spread(nodes, n)
+}
+
+// spread takes n of nodes, in new zones first, then in new racks,
+// then the rest, keeping the order of nodes in each pass
+func (m *Map) spread(nodes []string, n int) []string {
+	taken := make(map[string]bool, n)
+	zones := make(map[string]bool)
+	racks := make(map[Labels]bool)
+	res := make([]string, 0, n)
+	take := func(ok func(l Labels) bool) {
+		for _, node := range nodes {
+			if len(res) == n {
+				return
+			}
+			if l := m.labels[node]; !taken[node] && ok(l) {
+				taken[node], zones[l.Zone], racks[l] = true, true, true
+				res = append(res, node)
+			}
+		}
+	}
+	take(func(l Labels) bool { return !zones[l.Zone] })
+	take(func(l Labels) bool { return !racks[l] })
+	take(func(l Labels) bool { return true })
+	return res
+}
+
+// LocateBounded is Locate with bounded loads (Mirrokni et al.): a node
+// takes up to (1+epsilon) times its weighted share of the loads in
+// flight, plus the new one. k goes clockwise past the full nodes to
+// the first one with room. loads has the loads of nodes.
+func (m *Map) LocateBounded(k string, loads map[string]int, epsilon float64) string {
+	if len(k) == 0 || len(m.ring) == 0 {
+		return ""
+	}
+	total, weights := 1, 0
+	for node, w := range m.weights {
+		total += loads[node]
+		weights += w
+	}
+
+	idx := m.search(k)
+	seen := make(map[string]bool, len(m.weights))
+	for i := 0; i < len(m.ring) && len(seen) < len(m.weights); i++ {
+		node := m.ring[(idx+i)%len(m.ring)].node
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		capacity := math.Ceil((1 + epsilon) * float64(total) * float64(m.weights[node]) / float64(weights))
+		if float64(loads[node]) < capacity {
+			return node
+		}
+	}
+	// unreachable, the capacities add up to more than the loads
+	return m.ring[idx].node
 }
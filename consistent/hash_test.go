@@ -1,6 +1,9 @@
 package consistent
 
 import (
+	"hash/fnv"
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -38,3 +41,180 @@ func TestHash(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	hash.Add("2", "4", "6")
+	hash.Remove("4", "8")
+
+	// 2, 6, 12, 16, 22, 26
+	cases := map[string]string{
+		"3":  "6",
+		"13": "6",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range cases {
+		if hash.Locate(k) != v {
+			t.Errorf("%s should map to %s", k, v)
+		}
+	}
+	if hash.Has("4") || !hash.Has("2") {
+		t.Errorf("4 should be removed and 2 kept")
+	}
+	if nodes := hash.Nodes(); len(nodes) != 2 || nodes[0] != "2" || nodes[1] != "6" {
+		t.Errorf("nodes should be [2 6], got %v", nodes)
+	}
+
+	hash.Remove("2", "6")
+	if v := hash.Locate("3"); v != "" {
+		t.Errorf("empty map should locate nothing, got %s", v)
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	// crc32 spreads the few virtual keys too unevenly to check shares
+	hash := New(50, func(data []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(data)
+		return h.Sum32()
+	})
+	hash.Add("small")
+	hash.AddWeighted("big", 4)
+
+	shares := hash.Shares()
+	if sum := shares["small"] + shares["big"]; math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("shares should sum to 1, got %v", sum)
+	}
+	if shares["big"] < 0.7 || shares["big"] > 0.9 {
+		t.Fatalf("big should own about 80%% of the keyspace, got %v", shares["big"])
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Locate("key"+strconv.Itoa(i))]++
+	}
+	if got := float64(counts["big"]) / 10000; math.Abs(got-shares["big"]) > 0.05 {
+		t.Fatalf("big should serve its share %v of keys, got %v", shares["big"], got)
+	}
+
+	// reweighting replaces the virtual keys
+	hash.AddWeighted("big", 1)
+	if len(hash.ring) != 100 {
+		t.Fatalf("reweighted map should have 100 virtual keys, got %d", len(hash.ring))
+	}
+}
+
+func TestLocateBounded(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("2", "4", "6")
+
+	// with 3 loads in flight and epsilon 0, a node takes up to 2
+	loads := map[string]int{"2": 0, "4": 2, "6": 1}
+	if v := hash.LocateBounded("13", loads, 0); v != "6" {
+		t.Errorf("13 should go past full 4 to 6, got %s", v)
+	}
+	if v := hash.LocateBounded("11", loads, 0); v != "2" {
+		t.Errorf("11 should stay on 2, got %s", v)
+	}
+
+	// 4 and 6 are full, wraps around to 2
+	loads = map[string]int{"2": 0, "4": 2, "6": 2}
+	if v := hash.LocateBounded("23", loads, 0); v != "2" {
+		t.Errorf("23 should wrap around to 2, got %s", v)
+	}
+	if v := hash.LocateBounded("23", loads, 1); v != "4" {
+		t.Errorf("23 should stay on 4 with a loose bound, got %s", v)
+	}
+}
+
+func TestLocateN(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("2", "4", "6")
+
+	if nodes := hash.LocateN("13", 2); !reflect.DeepEqual(nodes, []string{"4", "6"}) {
+		t.Errorf("13 should map to [4 6], got %v", nodes)
+	}
+	if nodes := hash.LocateN("25", 5); !reflect.DeepEqual(nodes, []string{"6", "2", "4"}) {
+		t.Errorf("25 should map to all nodes [6 2 4], got %v", nodes)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// all virtual keys collide on 0
+	collide := func(data []byte) uint32 { return 0 }
+
+	a := New(2, collide)
+	a.Add("x", "y")
+	b := New(2, collide)
+	b.Add("y", "x")
+	if a.Locate("k") != "x" || b.Locate("k") != "x" {
+		t.Fatalf("collision should go to the first node in order, got %s and %s", a.Locate("k"), b.Locate("k"))
+	}
+	if len(a.ring) != 4 {
+		t.Fatalf("colliding virtual keys should all be kept, got %d", len(a.ring))
+	}
+
+	// the other node keeps its virtual keys
+	a.Remove("x")
+	if a.Locate("k") != "y" || len(a.ring) != 2 {
+		t.Fatalf("y should take over, got %s with %d virtual keys", a.Locate("k"), len(a.ring))
+	}
+}
+
+func TestNew64(t *testing.T) {
+	hash := New64(1000, nil)
+	for i := 0; i < 10; i++ {
+		hash.Add("node" + strconv.Itoa(i))
+	}
+	for node, share := range hash.Shares() {
+		if math.Abs(share-0.1) > 0.02 {
+			t.Errorf("%s should own about 10%% of the keyspace, got %v", node, share)
+		}
+	}
+}
+
+func TestLocateNLabels(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	// 2, 3, 4, 5, 12, 13, 14, 15, 22, 23, 24, 25
+	hash.Add("2", "3", "4", "5")
+	hash.SetLabels("2", Labels{Zone: "a", Rack: "r1"})
+	hash.SetLabels("3", Labels{Zone: "a", Rack: "r1"})
+	hash.SetLabels("4", Labels{Zone: "a", Rack: "r2"})
+	hash.SetLabels("5", Labels{Zone: "b", Rack: "r1"})
+
+	cases := []struct {
+		k     string
+		n     int
+		nodes []string
+	}{
+		{"11", 2, []string{"2", "5"}},           // 3 and 4 are in zone a too
+		{"11", 3, []string{"2", "5", "4"}},      // then a new rack
+		{"11", 4, []string{"2", "5", "4", "3"}}, // then the rest
+		{"14", 2, []string{"4", "5"}},
+	}
+	for _, c := range cases {
+		if nodes := hash.LocateN(c.k, c.n); !reflect.DeepEqual(nodes, c.nodes) {
+			t.Errorf("%s should map to %v, got %v", c.k, c.nodes, nodes)
+		}
+	}
+
+	hash.SetLabels("5", Labels{})
+	if hash.Labels("5") != (Labels{}) {
+		t.Errorf("zero labels should unlabel 5")
+	}
+}
@@ -0,0 +1,100 @@
+package consistent
+
+// Jump is jump consistent hashing over a list of slots, a node has
+// weight slots. Slots are in the order of node names, so every node
+// builds the same list whatever the order of adding. It needs little
+// memory and balances well, but only a node last in name order moves
+// few keys when it joins or leaves, the slots after any other one shift
+// and their keys move too. Name nodes to grow and shrink at the end.
+type Jump struct {
+	hash    Hash
+	weights map[string]int
+	slots   []string // sorted by node
+}
+
+// NewJump creates a Jump, fn can be nil
+func NewJump(fn Hash) *Jump {
+	if fn == nil {
+		fn = defaultHash
+	}
+	return &Jump{hash: fn, weights: make(map[string]int)}
+}
+
+// AddWeighted adds node with weight slots
+func (j *Jump) AddWeighted(node string, weight int) {
+	checkWeight(weight)
+	j.weights[node] = weight
+	j.build()
+}
+
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(j.weights, node)
+	}
+	j.build()
+}
+
+// build lays the slots of nodes out in name order
+func (j *Jump) build() {
+	j.slots = j.slots[:0]
+	for _, node := range sortedNodes(j.weights) {
+		for i := 0; i < j.weights[node]; i++ {
+			j.slots = append(j.slots, node)
+		}
+	}
+}
+
+func (j *Jump) Has(node string) bool {
+	_, ok := j.weights[node]
+	return ok
+}
+
+func (j *Jump) Nodes() []string {
+	return sortedNodes(j.weights)
+}
+
+func (j *Jump) Locate(k string) string {
+	if len(k) == 0 || len(j.slots) == 0 {
+		return ""
+	}
+	return j.slots[jump(uint64(mix(j.hash([]byte(k)))), len(j.slots))]
+}
+
+// LocateN returns the node of k's slot, then the nodes of the
+// following slots
+func (j *Jump) LocateN(k string, n int) []string {
+	if len(k) == 0 || len(j.slots) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.weights) {
+		n = len(j.weights)
+	}
+	first := jump(uint64(mix(j.hash([]byte(k)))), len(j.slots))
+	nodes := make([]string, 0, n)
+	for i := 0; len(nodes) < n; i++ {
+		if node := j.slots[(first+i)%len(j.slots)]; !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Shares returns the expected shares, in proportion to weights
+func (j *Jump) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(j.weights))
+	for node, w := range j.weights {
+		shares[node] = float64(w) / float64(len(j.slots))
+	}
+	return shares
+}
+
+// jump returns the bucket of key in [0, n), by Lamping and Veach
+func jump(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,125 @@
+package consistent
+
+// DefaultMaglevSize is the default size of a Maglev lookup table
+const DefaultMaglevSize = 65537
+
+// Maglev is Google's Maglev hashing: nodes take turns to fill a lookup
+// table by their own permutation of it, and a key goes to the node of
+// its table entry. Locate is a lookup and the balance is near perfect,
+// but the table is rebuilt on each change and a few keys of other
+// nodes move too.
+type Maglev struct {
+	hash    Hash
+	size    int // prime, much larger than the number of nodes
+	weights map[string]int
+	table   []string
+}
+
+// NewMaglev creates a Maglev with a table of size entries, size
+// should be a prime, DefaultMaglevSize if zero. fn can be nil.
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size == 0 {
+		size = DefaultMaglevSize
+	}
+	if fn == nil {
+		fn = defaultHash
+	}
+	return &Maglev{hash: fn, size: size, weights: make(map[string]int)}
+}
+
+// AddWeighted adds node, it takes weight entries in each turn
+func (m *Maglev) AddWeighted(node string, weight int) {
+	checkWeight(weight)
+	m.weights[node] = weight
+	m.populate()
+}
+
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(m.weights, node)
+	}
+	m.populate()
+}
+
+func (m *Maglev) Has(node string) bool {
+	_, ok := m.weights[node]
+	return ok
+}
+
+func (m *Maglev) Nodes() []string {
+	return sortedNodes(m.weights)
+}
+
+func (m *Maglev) Locate(k string) string {
+	if len(k) == 0 || len(m.table) == 0 {
+		return ""
+	}
+	return m.table[int(mix(m.hash([]byte(k))))%m.size]
+}
+
+// LocateN returns the node of k's entry, then the nodes of
+// the following entries
+func (m *Maglev) LocateN(k string, n int) []string {
+	if len(k) == 0 || len(m.table) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+	first := int(mix(m.hash([]byte(k)))) % m.size
+	nodes := make([]string, 0, n)
+	for i := 0; i < m.size && len(nodes) < n; i++ {
+		if node := m.table[(first+i)%m.size]; !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Shares returns the share of table entries of each node
+func (m *Maglev) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(m.weights))
+	for node := range m.weights {
+		shares[node] = 0
+	}
+	for _, node := range m.table {
+		shares[node] += 1 / float64(m.size)
+	}
+	return shares
+}
+
+// populate fills the table, each node walks its permutation
+// offset, offset+skip, ... to the next free entry in its turn
+func (m *Maglev) populate() {
+	nodes := sortedNodes(m.weights)
+	if len(nodes) == 0 {
+		m.table = nil
+		return
+	}
+	offsets := make([]int, len(nodes))
+	skips := make([]int, len(nodes))
+	for i, node := range nodes {
+		offsets[i] = int(mix(m.hash([]byte("offset"+node)))) % m.size
+		skips[i] = int(mix(m.hash([]byte("skip"+node))))%(m.size-1) + 1
+	}
+
+	table := make([]string, m.size)
+	next := make([]int, len(nodes)) // next index of each permutation
+	for filled := 0; ; {
+		for i, node := range nodes {
+			for w := 0; w < m.weights[node]; w++ {
+				c := (offsets[i] + next[i]*skips[i]) % m.size
+				for table[c] != "" {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[c] = node
+				next[i]++
+				if filled++; filled == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
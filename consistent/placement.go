@@ -0,0 +1,77 @@
+package consistent
+
+import "sort"
+
+// Placement places keys on nodes, so each node serves a share of
+// the keyspace and few keys move when nodes join or leave. Map is
+// the vnode ring, Rendezvous, Jump and Maglev are the alternatives.
+// It's not safe for concurrency.
+type Placement interface {
+	// AddWeighted adds node, or sets its weight if it's there
+	AddWeighted(node string, weight int)
+	Remove(nodes ...string)
+	Has(node string) bool
+	// Nodes returns the nodes, sorted
+	Nodes() []string
+	// Locate returns the node of k, "" if there's no node
+	Locate(k string) string
+	// LocateN returns up to n distinct nodes of k, Locate's first.
+	// The others are the next owners, to replicate k or fail over to.
+	LocateN(k string, n int) []string
+	// Shares returns the expected share of keys of each node
+	Shares() map[string]float64
+}
+
+var (
+	_ Placement = (*Map)(nil)
+	_ Placement = (*Rendezvous)(nil)
+	_ Placement = (*Jump)(nil)
+	_ Placement = (*Maglev)(nil)
+)
+
+// mix scrambles the bits of a hash, crc32 of similar inputs
+// is too similar to be used without it
+func mix(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// mix64 is mix for 64-bit hashes
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// sortedNodes returns the keys of weights, sorted
+func sortedNodes(weights map[string]int) []string {
+	nodes := make([]string, 0, len(weights))
+	for node := range weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// contains tells whether node is in nodes, n is small
+func contains(nodes []string, node string) bool {
+	for _, v := range nodes {
+		if v == node {
+			return true
+		}
+	}
+	return false
+}
+
+func checkWeight(weight int) {
+	if weight <= 0 {
+		panic("consistent: weight should be positive")
+	}
+}
@@ -0,0 +1,134 @@
+package consistent
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+var placements = map[string]func() Placement{
+	"ring":       func() Placement { return New(100, nil) },
+	"ring64":     func() Placement { return New64(100, nil) },
+	"rendezvous": func() Placement { return NewRendezvous(nil) },
+	"jump":       func() Placement { return NewJump(nil) },
+	"maglev":     func() Placement { return NewMaglev(0, nil) },
+}
+
+const numKeys = 20000
+
+// locateAll returns the node of each key
+func locateAll(p Placement) []string {
+	nodes := make([]string, numKeys)
+	for i := range nodes {
+		nodes[i] = p.Locate("key" + strconv.Itoa(i))
+	}
+	return nodes
+}
+
+// moved returns the fraction of keys on different nodes
+func moved(before, after []string) float64 {
+	n := 0
+	for i := range before {
+		if before[i] != after[i] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(before))
+}
+
+func TestPlacementMovement(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		for i := 0; i < 10; i++ {
+			p.AddWeighted(fmt.Sprintf("node%02d", i), 1)
+		}
+		before := locateAll(p)
+
+		// ideally 1/11 of keys move to the new node
+		p.AddWeighted("node10", 1)
+		added := locateAll(p)
+		if m := moved(before, added); m > 2.0/11 {
+			t.Errorf("%s: %.3f of keys moved on adding 1 node to 10", name, m)
+		}
+		for i := range before {
+			if before[i] != added[i] && added[i] != "node10" {
+				if name != "maglev" { // a few keys are shuffled by the rebuilt table
+					t.Errorf("%s: key%d moved to an old node %s", name, i, added[i])
+					break
+				}
+			}
+		}
+
+		// ideally 1/11 of keys move off the removed node, jump
+		// only keeps that for the last node in name order
+		node := "node03"
+		if name == "jump" {
+			node = "node10"
+		}
+		p.Remove(node)
+		removed := locateAll(p)
+		if m := moved(added, removed); m > 2.0/11 {
+			t.Errorf("%s: %.3f of keys moved on removing 1 node of 11", name, m)
+		}
+		t.Logf("%s: moved %.3f on add, %.3f on remove", name, moved(before, added), moved(added, removed))
+	}
+}
+
+func TestPlacementBalance(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		p.AddWeighted("a", 1)
+		p.AddWeighted("b", 1)
+		p.AddWeighted("c", 2)
+
+		shares := p.Shares()
+		counts := make(map[string]int)
+		for _, node := range locateAll(p) {
+			counts[node]++
+		}
+		for node, share := range shares {
+			got := float64(counts[node]) / numKeys
+			if math.Abs(got-share) > 0.05 {
+				t.Errorf("%s: %s serves %.3f of keys, expected %.3f", name, node, got, share)
+			}
+		}
+		if !p.Has("c") || len(p.Nodes()) != 3 {
+			t.Errorf("%s: nodes should be a b c, got %v", name, p.Nodes())
+		}
+		t.Logf("%s: shares %v", name, shares)
+	}
+}
+
+func TestPlacementEmpty(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		p.AddWeighted("a", 1)
+		p.Remove("a")
+		if node := p.Locate("key"); node != "" || p.Has("a") {
+			t.Errorf("%s: empty placement should locate nothing, got %q", name, node)
+		}
+	}
+}
+
+func TestPlacementLocateN(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		for i := 0; i < 5; i++ {
+			p.AddWeighted("node"+strconv.Itoa(i), 1+i%2)
+		}
+		for i := 0; i < 100; i++ {
+			k := "key" + strconv.Itoa(i)
+			nodes := p.LocateN(k, 3)
+			if len(nodes) != 3 || nodes[0] != p.Locate(k) {
+				t.Fatalf("%s: %s should have 3 nodes led by %s, got %v", name, k, p.Locate(k), nodes)
+			}
+			if nodes[0] == nodes[1] || nodes[0] == nodes[2] || nodes[1] == nodes[2] {
+				t.Fatalf("%s: nodes of %s should be distinct, got %v", name, k, nodes)
+			}
+		}
+		if nodes := p.LocateN("key", 10); len(nodes) != 5 {
+			t.Errorf("%s: n should be capped at all nodes, got %v", name, nodes)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package consistent
+
+import (
+	"math"
+	"sort"
+)
+
+// Rendezvous is highest random weight hashing: each key goes to the
+// node with the highest score of (node, key). It needs no memory but
+// the nodes, and only the keys of a removed node move, at the cost
+// of scoring all nodes in Locate.
+type Rendezvous struct {
+	hash    Hash
+	weights map[string]int
+	nodes   []string // sorted
+}
+
+// NewRendezvous creates a Rendezvous, fn can be nil
+func NewRendezvous(fn Hash) *Rendezvous {
+	if fn == nil {
+		fn = defaultHash
+	}
+	return &Rendezvous{hash: fn, weights: make(map[string]int)}
+}
+
+// AddWeighted adds node, its share of keys scales with weight
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	checkWeight(weight)
+	r.weights[node] = weight
+	r.nodes = sortedNodes(r.weights)
+}
+
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(r.weights, node)
+	}
+	r.nodes = sortedNodes(r.weights)
+}
+
+func (r *Rendezvous) Has(node string) bool {
+	_, ok := r.weights[node]
+	return ok
+}
+
+func (r *Rendezvous) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// Locate returns the node of the highest score, ties go to
+// the first node in order
+func (r *Rendezvous) Locate(k string) string {
+	if len(k) == 0 {
+		return ""
+	}
+	var best string
+	bestScore := math.Inf(-1)
+	for _, node := range r.nodes {
+		if score := r.score(node, k); score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// LocateN returns the n nodes of the highest scores, the
+// ones k would go to if the better ones were removed
+func (r *Rendezvous) LocateN(k string, n int) []string {
+	if len(k) == 0 || n <= 0 {
+		return nil
+	}
+	scores := make(map[string]float64, len(r.nodes))
+	nodes := append([]string(nil), r.nodes...)
+	for _, node := range nodes {
+		scores[node] = r.score(node, k)
+	}
+	// stable keeps ties in node order, as Locate does
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return scores[nodes[i]] > scores[nodes[j]]
+	})
+	if n < len(nodes) {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+// score is the weighted score -weight/ln(u), where u is the hash
+// of (node, k) in (0, 1). A node wins keys in proportion to weight.
+func (r *Rendezvous) score(node, k string) float64 {
+	u := (float64(mix(r.hash([]byte(node+k)))) + 0.5) / (1 << 32)
+	return -float64(r.weights[node]) / math.Log(u)
+}
+
+// Shares returns the expected shares, in proportion to weights
+func (r *Rendezvous) Shares() map[string]float64 {
+	total := 0
+	for _, w := range r.weights {
+		total += w
+	}
+	shares := make(map[string]float64, len(r.weights))
+	for node, w := range r.weights {
+		shares[node] = float64(w) / float64(total)
+	}
+	return shares
+}
@@ -0,0 +1,31 @@
+package consistent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// SeededHash64 returns a hash keyed with seed by HMAC-SHA256. Nodes
+// sharing seed place keys the same, while without seed no one can
+// tell which node a key goes to, or craft keys flooding one node.
+func SeededHash64(seed []byte) Hash64 {
+	seed = append([]byte(nil), seed...)
+	return func(data []byte) uint64 {
+		return binary.BigEndian.Uint64(hmacSum(seed, data))
+	}
+}
+
+// SeededHash is SeededHash64 for the placements of 32-bit hashes
+func SeededHash(seed []byte) Hash {
+	seed = append([]byte(nil), seed...)
+	return func(data []byte) uint32 {
+		return binary.BigEndian.Uint32(hmacSum(seed, data))
+	}
+}
+
+func hmacSum(seed, data []byte) []byte {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
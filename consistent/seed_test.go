@@ -0,0 +1,35 @@
+package consistent
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSeededHash(t *testing.T) {
+	a := New64(50, SeededHash64([]byte("secret")))
+	b := New64(50, SeededHash64([]byte("secret")))
+	other := New64(50, SeededHash64([]byte("other")))
+	for _, m := range []*Map{a, b, other} {
+		m.Add("node0", "node1", "node2")
+	}
+
+	differ := 0
+	for i := 0; i < 1000; i++ {
+		k := "key" + strconv.Itoa(i)
+		if a.Locate(k) != b.Locate(k) {
+			t.Fatalf("nodes with the same seed should place %s the same", k)
+		}
+		if a.Locate(k) != other.Locate(k) {
+			differ++
+		}
+	}
+	// about 2/3 of keys go elsewhere with another seed
+	if differ < 500 {
+		t.Fatalf("another seed should place keys differently, only %d of 1000 differ", differ)
+	}
+
+	h := SeededHash([]byte("secret"))
+	if h([]byte("key")) != h([]byte("key")) || h([]byte("key")) == SeededHash([]byte("other"))([]byte("key")) {
+		t.Fatalf("32-bit hash should be keyed by seed")
+	}
+}
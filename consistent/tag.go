@@ -0,0 +1,21 @@
+package consistent
+
+import "strings"
+
+// TagFunc returns the part of k to hash, keys with the same
+// part are placed on the same node. Placements hash whole keys,
+// the caller applies it, e.g. Group.SetHashTag of core.
+type TagFunc func(k string) string
+
+// HashTag is the TagFunc of Redis hash tags: if k has a non-empty
+// {...}, only the part in the first braces is hashed, so
+// {user42}:profile and {user42}:prefs go to the same node.
+// Otherwise the whole k is hashed.
+func HashTag(k string) string {
+	if i := strings.IndexByte(k, '{'); i >= 0 {
+		if j := strings.IndexByte(k[i+1:], '}'); j > 0 {
+			return k[i+1 : i+1+j]
+		}
+	}
+	return k
+}
@@ -0,0 +1,21 @@
+package consistent
+
+import "testing"
+
+func TestHashTag(t *testing.T) {
+	cases := map[string]string{
+		"{user42}:profile": "user42",
+		"{user42}:prefs":   "user42",
+		"order:{user42}":   "user42",
+		"{}:empty":         "{}:empty",
+		"{open":            "{open",
+		"a{b}{c}":          "b",
+		"plain":            "plain",
+	}
+	for k, v := range cases {
+		if got := HashTag(k); got != v {
+			t.Errorf("HashTag(%q) = %q, want %q", k, got, v)
+		}
+	}
+
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultAdminPath = "/_mycache_admin/"
+
+// Admin serves the settings of groups over HTTP, to tune them without
+// restarting:
+//
+//	GET /<basepath>/<groupname>/config returns the group's Config in JSON
+//	PUT /<basepath>/<groupname>/config changes the settings given in JSON
+//
+// It has no auth, serve it on its own address reachable by operators
+// only, not on the listener of peers or users.
+type Admin struct {
+	basePath string
+}
+
+func NewAdmin() *Admin {
+	return &Admin{basePath: defaultAdminPath}
+}
+
+// BasePath returns the path prefix Admin serves at
+func (a *Admin) BasePath() string {
+	return a.basePath
+}
+
+// configJSON is Config in JSON, durations are in time.Duration's format
+type configJSON struct {
+	MaxBytes     int64          `json:"max_bytes"`
+	TTL          string         `json:"ttl"`
+	Eviction     EvictionPolicy `json:"eviction"`
+	MaxInFlight  int            `json:"max_in_flight"`
+	MaxQueue     int            `json:"max_queue"`
+	QueueTimeout string         `json:"queue_timeout"`
+	DedupeWindow string         `json:"dedupe_window"`
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, a.basePath) {
+		panic("Admin serving unexpected path: " + r.URL.Path)
+	}
+
+	// /<basepath>/<groupname>/config
+	parts := strings.SplitN(r.URL.Path[len(a.basePath):], "/", 2)
+	if len(parts) != 2 || parts[1] != "config" {
+		http.Error(w, "bad request, should be /basepath/groupname/config", http.StatusBadRequest)
+		return
+	}
+	group := GetGroup(parts[0])
+	if group == nil {
+		http.Error(w, "no such group"+parts[0], http.StatusNotFound)
+		return
+	}
+
+	cfg := group.Config()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		// fields absent in body keep their current values
+		body := toConfigJSON(cfg)
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if cfg, err = body.config(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := group.Reconfigure(cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toConfigJSON(group.Config()))
+}
+
+func toConfigJSON(cfg Config) configJSON {
+	return configJSON{
+		MaxBytes:     cfg.MaxBytes,
+		TTL:          cfg.TTL.String(),
+		Eviction:     cfg.Eviction,
+		MaxInFlight:  cfg.Limit.MaxInFlight,
+		MaxQueue:     cfg.Limit.MaxQueue,
+		QueueTimeout: cfg.Limit.QueueTimeout.String(),
+		DedupeWindow: cfg.DedupeWindow.String(),
+	}
+}
+
+func (c configJSON) config() (Config, error) {
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return Config{}, err
+	}
+	timeout, err := time.ParseDuration(c.QueueTimeout)
+	if err != nil {
+		return Config{}, err
+	}
+	window, err := time.ParseDuration(c.DedupeWindow)
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		MaxBytes: c.MaxBytes,
+		TTL:      ttl,
+		Eviction: c.Eviction,
+		Limit: LimitOptions{
+			MaxInFlight:  c.MaxInFlight,
+			MaxQueue:     c.MaxQueue,
+			QueueTimeout: timeout,
+		},
+		DedupeWindow: window,
+	}, nil
+}
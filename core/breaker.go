@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a load fails fast, because the
+// group's getter keeps failing
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // loads go through
+	BreakerOpen                         // loads fail fast
+	BreakerHalfOpen                     // a single probe load goes through
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOptions controls when the breaker trips
+type BreakerOptions struct {
+	Window      time.Duration // the error rate is counted per window
+	MinRequests int           // loads needed in a window before tripping
+	Threshold   float64       // error rate in (0, 1] that trips the breaker
+	Cooldown    time.Duration // how long to stay open before probing
+}
+
+// breaker fails loads fast once the getter's error rate
+// crosses the threshold, and probes it again after cooldown
+type breaker struct {
+	opts  BreakerOptions
+	stats *Stats
+
+	mu       sync.Mutex
+	state    BreakerState
+	start    time.Time // window start, or when it opened
+	total    int
+	failures int
+	probing  bool // a half-open probe is in flight
+}
+
+func newBreaker(opts BreakerOptions, stats *Stats) *breaker {
+	return &breaker{opts: opts, stats: stats, start: time.Now()}
+}
+
+// allow reports whether a load may call the getter, a true
+// must be followed by a record of its result, or a cancel
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.start) < b.opts.Cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen, now)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record counts the result of a load allowed by allow
+func (b *breaker) record(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		if ok {
+			b.setState(BreakerClosed, now)
+		} else {
+			b.setState(BreakerOpen, now)
+		}
+		return
+	case BreakerOpen:
+		return // allowed before the breaker opened
+	}
+
+	if now.Sub(b.start) > b.opts.Window {
+		b.start, b.total, b.failures = now, 0, 0
+	}
+	b.total++
+	if !ok {
+		b.failures++
+	}
+	if b.failures > 0 && b.total >= b.opts.MinRequests &&
+		float64(b.failures) >= b.opts.Threshold*float64(b.total) {
+		b.setState(BreakerOpen, now)
+	}
+}
+
+// cancel ends a load allowed by allow without counting it,
+// when its result tells nothing of the getter's health
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+	b.mu.Unlock()
+}
+
+func (b *breaker) setState(s BreakerState, now time.Time) {
+	b.state = s
+	b.start, b.total, b.failures = now, 0, 0
+	b.stats.BreakerState.Set(int64(s))
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	stats := &Stats{}
+	b := newBreaker(BreakerOptions{
+		Window:      time.Second,
+		MinRequests: 4,
+		Threshold:   0.5,
+		Cooldown:    time.Second,
+	}, stats)
+	now := time.Now()
+
+	for _, ok := range []bool{true, false, true} {
+		if !b.allow(now) {
+			t.Fatalf("closed breaker should allow")
+		}
+		b.record(ok, now)
+	}
+	b.allow(now)
+	b.record(false, now)
+	if BreakerState(stats.BreakerState.Get()) != BreakerOpen {
+		t.Fatalf("breaker should open at 50%% error rate")
+	}
+	if b.allow(now.Add(time.Millisecond)) {
+		t.Fatalf("open breaker should fail fast")
+	}
+
+	// after cooldown, only one probe goes through
+	now = now.Add(2 * time.Second)
+	if !b.allow(now) || b.allow(now) {
+		t.Fatalf("half-open breaker should allow a single probe")
+	}
+	b.record(true, now)
+	if BreakerState(stats.BreakerState.Get()) != BreakerClosed {
+		t.Fatalf("breaker should close after a good probe")
+	}
+}
+
+func TestBreakerLoadCycle(t *testing.T) {
+	var fail int32 = 1
+	var g *Group
+	g = NewGroup("breaker-cycle", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, k string) ([]byte, error) {
+			if k == "self" {
+				v, err := g.GetContext(ctx, k)
+				return v.ByteSlice(), err
+			}
+			if atomic.LoadInt32(&fail) == 1 {
+				return nil, fmt.Errorf("db is down")
+			}
+			return []byte(k), nil
+		}))
+	g.EnableBreaker(BreakerOptions{Window: time.Second, MinRequests: 1, Threshold: 0.5, Cooldown: 10 * time.Millisecond})
+
+	g.Get("Tom")
+	if g.BreakerState() != BreakerOpen {
+		t.Fatalf("breaker should open")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// the probe ends in a cycle, which must not hold the breaker half-open
+	var cycle *ErrLoadCycle
+	if _, err := g.Get("self"); !errors.As(err, &cycle) {
+		t.Fatalf("probe should fail with a cycle, got %v", err)
+	}
+	atomic.StoreInt32(&fail, 0)
+	if _, err := g.Get("Sam"); err != nil || g.BreakerState() != BreakerClosed {
+		t.Fatalf("next probe should close the breaker, got %v in %v", err, g.BreakerState())
+	}
+}
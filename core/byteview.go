@@ -1,8 +1,11 @@
 package core
 
+import "time"
+
 // ByteView is read-only view of bytes, who implements Value
 type ByteView struct {
-	bs []byte // bs stores the real cache content in any type
+	bs []byte    // bs stores the real cache content in any type
+	e  time.Time // expire time, zero means never expire
 }
 
 // Len returns the view's length
@@ -10,14 +13,23 @@ func (v ByteView) Len() int {
 	return len(v.bs)
 }
 
+// Expire returns the view's expire time, zero means never expire
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
 func (v *ByteView) ByteSlice() []byte {
 	return clone(v.bs)
 }
 
-func (v *ByteView) String() string {
+func (v ByteView) String() string {
 	return string(v.bs)
 }
 
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
+}
+
 func clone(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
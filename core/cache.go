@@ -2,7 +2,11 @@ package core
 
 import (
 	"github/mycache/lru"
+	"github/mycache/radix"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // cache is a wrapper around an *lru.Cache that adds synchronization,
@@ -11,17 +15,43 @@ type cache struct {
 	mu       sync.Mutex
 	lru      *lru.Cache
 	maxBytes int64
+	onEvict  func(k string, v ByteView, reason EvictReason) // called with mu held
+	reason   EvictReason                                    // reason of the current eviction
+	tags     tagIndex
+	index    *radix.Tree // ordered keys, nil if disabled
+	policy   lru.Policy
 }
 
-func (c *cache) add(k string, v ByteView) {
+// add adds k with its tags, the old tags of k are replaced
+func (c *cache) add(k string, v ByteView, tags ...string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
-		c.lru = lru.New(c.maxBytes, nil)
+		c.lru = lru.New(c.maxBytes, c.evicted)
+		c.lru.SetPolicy(c.policy)
 	}
 	c.lru.Add(k, v)
+	if _, ok := c.lru.Get(k); ok { // may be too large to fit
+		c.tags.add(k, tags)
+		if c.index != nil {
+			c.index.Insert(k)
+		}
+	}
+}
+
+// removeTag drops keys tagged with tag, returns how many are dropped
+func (c *cache) removeTag(tag string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := c.tags.lookup(tag)
+	for _, k := range keys {
+		c.remove(k, EvictInvalidated)
+	}
+	return len(keys)
 }
 
+// get returns the view of k, expired view is dropped and
+// reported as a miss
 func (c *cache) get(k string) (v ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -29,7 +59,133 @@ func (c *cache) get(k string) (v ByteView, ok bool) {
 		return
 	}
 	if v, ok := c.lru.Get(k); ok {
-		return v.(ByteView), ok
+		view := v.(ByteView)
+		if view.expired(time.Now()) {
+			c.remove(k, EvictExpired)
+			return ByteView{}, false
+		}
+		return view, ok
 	}
 	return
 }
+
+// remove drops k for reason, with mu held
+func (c *cache) remove(k string, reason EvictReason) {
+	c.reason = reason
+	c.lru.Delete(k)
+	c.reason = EvictCapacity
+}
+
+// resize changes maxBytes, entries are evicted at once to fit
+func (c *cache) resize(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	if c.lru != nil {
+		c.lru.SetMaxBytes(maxBytes)
+	}
+}
+
+func (c *cache) setPolicy(p lru.Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = p
+	if c.lru != nil {
+		c.lru.SetPolicy(p)
+	}
+}
+
+// removeKey drops k, returns false if k is absent
+func (c *cache) removeKey(k string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return false
+	}
+	if _, ok := c.lru.Get(k); !ok {
+		return false
+	}
+	c.remove(k, EvictInvalidated)
+	return true
+}
+
+// removePrefix drops keys with prefix, returns how many are dropped
+func (c *cache) removePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := c.scan(prefix, 0)
+	for _, k := range keys {
+		c.remove(k, EvictInvalidated)
+	}
+	return len(keys)
+}
+
+// keysWithPrefix returns at most limit keys with prefix in order,
+// all of them if limit <= 0
+func (c *cache) keysWithPrefix(prefix string, limit int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.scan(prefix, limit)
+}
+
+// scan walks the ordered index if enabled, or all keys otherwise,
+// with mu held
+func (c *cache) scan(prefix string, limit int) []string {
+	var keys []string
+	if c.index != nil {
+		c.index.Walk(prefix, func(k string) bool {
+			keys = append(keys, k)
+			return limit <= 0 || len(keys) < limit
+		})
+		return keys
+	}
+
+	if c.lru == nil {
+		return nil
+	}
+	for _, k := range c.lru.Keys(0) {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+// enableIndex keeps an ordered index of keys, to scan by prefix fast
+func (c *cache) enableIndex() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index != nil {
+		return
+	}
+	c.index = radix.New()
+	if c.lru != nil {
+		for _, k := range c.lru.Keys(0) {
+			c.index.Insert(k)
+		}
+	}
+}
+
+func (c *cache) evicted(k string, v lru.Value) {
+	c.tags.remove(k)
+	if c.index != nil {
+		c.index.Delete(k)
+	}
+	if c.onEvict != nil {
+		c.onEvict(k, v.(ByteView), c.reason)
+	}
+}
+
+// keys returns at most n keys from the most recently used
+func (c *cache) keys(n int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
+	}
+	return c.lru.Keys(n)
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"github/mycache/lru"
+	"time"
+)
+
+// EvictionPolicy decides which entry is evicted first when
+// the cache is full
+type EvictionPolicy string
+
+const (
+	EvictionLRU  EvictionPolicy = "lru"  // the least recently used
+	EvictionFIFO EvictionPolicy = "fifo" // the oldest loaded
+)
+
+// Config is the settings of a group that can change live
+type Config struct {
+	MaxBytes int64         // byte budget of the cache, zero means no limit
+	TTL      time.Duration // zero means never expire
+	Eviction EvictionPolicy
+	Limit    LimitOptions // getter loads are unlimited if Limit.MaxInFlight is zero
+
+	// DedupeWindow keeps a completed load, errors included, for
+	// callers of the same key right after it. Errors of the caller,
+	// cancellation and shedding, aren't kept. Zero turns it off.
+	DedupeWindow time.Duration
+}
+
+// Config returns the current settings of the group
+func (g *Group) Config() Config {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.cfg
+}
+
+// Reconfigure applies cfg to the live group. Shrinking the byte budget
+// evicts entries at once, a new TTL applies to entries loaded since.
+// Read the current Config, change it and pass it back to change
+// some settings only.
+func (g *Group) Reconfigure(cfg Config) error {
+	policy, err := cfg.Eviction.policy()
+	if err != nil {
+		return err
+	}
+	if cfg.MaxBytes < 0 || cfg.TTL < 0 || cfg.DedupeWindow < 0 {
+		return fmt.Errorf("max bytes and durations should not be negative")
+	}
+	if cfg.Limit.MaxInFlight < 0 || cfg.Limit.MaxQueue < 0 {
+		return fmt.Errorf("load limits should not be negative")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cfg.Limit != g.cfg.Limit {
+		g.setLimit(cfg.Limit)
+	}
+	g.cfg = cfg
+	g.mainCache.setPolicy(policy)
+	g.mainCache.resize(cfg.MaxBytes)
+	g.loader.SetWindow(cfg.DedupeWindow)
+	return nil
+}
+
+func (p EvictionPolicy) policy() (lru.Policy, error) {
+	switch p {
+	case EvictionLRU:
+		return lru.LRU, nil
+	case EvictionFIFO:
+		return lru.FIFO, nil
+	}
+	return 0, fmt.Errorf("unknown eviction policy %q", p)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconfigure(t *testing.T) {
+	g := NewGroup("reconfigure", 0, GetterFunc(
+		func(k string) ([]byte, error) {
+			return []byte("12345"), nil
+		}))
+	for _, k := range []string{"k1", "k2", "k3"} {
+		g.Get(k)
+	}
+
+	cfg := g.Config()
+	cfg.MaxBytes = 14
+	cfg.TTL = time.Minute
+	if err := g.Reconfigure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if keys := g.HotKeys(0); len(keys) != 2 {
+		t.Fatalf("should evict down to 2 entries at once, got %v", keys)
+	}
+	if v, _ := g.Get("k4"); v.Expire().IsZero() {
+		t.Fatalf("new TTL should apply to loaded entries")
+	}
+
+	cfg.Eviction = "random"
+	if err := g.Reconfigure(cfg); err == nil {
+		t.Fatalf("unknown eviction policy should be rejected")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	g := NewGroup("admin", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			return []byte(k), nil
+		}))
+	srv := httptest.NewServer(NewAdmin())
+	defer srv.Close()
+
+	body := strings.NewReader(`{"ttl": "30s", "max_in_flight": 4}`)
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+defaultAdminPath+"admin/config", body)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var got configJSON
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("reconfigure failed: %v %v", res.Status, err)
+	}
+	expect := Config{MaxBytes: 2 << 10, TTL: 30 * time.Second, Eviction: EvictionLRU, Limit: LimitOptions{MaxInFlight: 4}}
+	if cfg := g.Config(); cfg != expect {
+		t.Fatalf("expect %+v, got %+v", expect, cfg)
+	}
+}
+
+func TestDedupeWindow(t *testing.T) {
+	var loads int32
+	g := NewGroup("dedupe", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return nil, fmt.Errorf("db is down")
+		}))
+	cfg := g.Config()
+	cfg.DedupeWindow = time.Minute
+	g.Reconfigure(cfg)
+
+	g.Get("Tom")
+	if _, err := g.Get("Tom"); err == nil || atomic.LoadInt32(&loads) != 1 {
+		t.Fatalf("error should be shared in window, got %v with %d loads", err, loads)
+	}
+}
+
+func TestDedupeWindowShedding(t *testing.T) {
+	var calls int32
+	g := NewGroup("window-shedding", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			return []byte(k), nil
+		}))
+	if err := g.Reconfigure(Config{MaxBytes: 2 << 10, Eviction: EvictionLRU, DedupeWindow: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the only slot is busy and there's no queue, the load is shed
+	g.EnableLoadLimit(LimitOptions{MaxInFlight: 1})
+	g.limiter.sem <- struct{}{}
+	var oe *OverloadError
+	if _, err := g.Get("Tom"); !errors.As(err, &oe) {
+		t.Fatalf("load should be shed, got %v", err)
+	}
+	<-g.limiter.sem
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("shedding should not be kept in the window, got %v %v", v, err)
+	}
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+	"strings"
+)
+
+// ContextGetter is a Getter that receives the context of the load.
+// A getter that loads other keys from groups should pass ctx to
+// their GetContext, so cycles of loads are detected.
+type ContextGetter interface {
+	Getter
+	GetContext(ctx context.Context, k string) ([]byte, error)
+}
+
+// ContextGetterFunc implements ContextGetter with a function
+type ContextGetterFunc func(ctx context.Context, k string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(k string) ([]byte, error) {
+	return f(context.Background(), k)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, k string) ([]byte, error) {
+	return f(ctx, k)
+}
+
+// ErrLoadCycle is returned when a load depends on itself, e.g. the getter
+// of A gets B, whose getter gets A. It would wait for itself forever.
+type ErrLoadCycle struct {
+	Path []string // group/key of the loads in the cycle, starting and ending with the repeated one
+}
+
+func (e *ErrLoadCycle) Error() string {
+	return "load cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// loadChain is the loads a context is in, the latest first
+type loadChain struct {
+	group, key string
+	parent     *loadChain
+}
+
+type loadChainKey struct{}
+
+// withLoad adds the load of k in group g to the chain of ctx,
+// or returns *ErrLoadCycle if ctx is already in it
+func withLoad(ctx context.Context, g, k string) (context.Context, error) {
+	parent, _ := ctx.Value(loadChainKey{}).(*loadChain)
+	for c := parent; c != nil; c = c.parent {
+		if c.group == g && c.key == k {
+			return nil, &ErrLoadCycle{Path: append(parent.path(c), g+"/"+k)}
+		}
+	}
+	return context.WithValue(ctx, loadChainKey{}, &loadChain{group: g, key: k, parent: parent}), nil
+}
+
+// path returns the loads of the chain back to from, the earliest first
+func (c *loadChain) path(from *loadChain) []string {
+	var path []string
+	for ; c != nil; c = c.parent {
+		path = append([]string{c.group + "/" + c.key}, path...)
+		if c == from {
+			break
+		}
+	}
+	return path
+}
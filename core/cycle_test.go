@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadCycle(t *testing.T) {
+	var users, orders *Group
+	users = NewGroup("cycle-users", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, k string) ([]byte, error) {
+			if k == "self" {
+				v, err := users.GetContext(ctx, k)
+				return v.ByteSlice(), err
+			}
+			v, err := orders.GetContext(ctx, k)
+			return v.ByteSlice(), err
+		}))
+	orders = NewGroup("cycle-orders", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, k string) ([]byte, error) {
+			v, err := users.GetContext(ctx, k)
+			return v.ByteSlice(), err
+		}))
+
+	tests := []struct {
+		k    string
+		path []string
+	}{
+		{"self", []string{"cycle-users/self", "cycle-users/self"}},
+		{"Tom", []string{"cycle-users/Tom", "cycle-orders/Tom", "cycle-users/Tom"}},
+	}
+	for _, tt := range tests {
+		done := make(chan error)
+		go func() {
+			_, err := users.Get(tt.k)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			var cycle *ErrLoadCycle
+			if !errors.As(err, &cycle) || !reflect.DeepEqual(cycle.Path, tt.path) {
+				t.Fatalf("load of %s should fail with cycle %v, got %v", tt.k, tt.path, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("load of %s deadlocked", tt.k)
+		}
+	}
+}
+
+func TestLoadChain(t *testing.T) {
+	// loading the same key in another chain is not a cycle
+	var g *Group
+	g = NewGroup("chain", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, k string) ([]byte, error) {
+			if k == "b" {
+				return []byte("b"), nil
+			}
+			v, err := g.GetContext(ctx, "b")
+			return append([]byte(k), v.ByteSlice()...), err
+		}))
+	for _, k := range []string{"a", "c"} {
+		if v, err := g.Get(k); err != nil || v.String() != k+"b" {
+			t.Fatalf("Get(%s) = %v, %v", k, v, err)
+		}
+	}
+}
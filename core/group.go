@@ -2,11 +2,16 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github/mycache/consistent"
 	"github/mycache/pb"
 	"github/mycache/singleflight"
 	"log"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
 var (
@@ -32,56 +37,348 @@ type Group struct {
 	getter    Getter // called when all caches are missed
 	mainCache cache  // cache data
 	peers     PeerPicker
+	// picks peers by a part of keys, nil if by the whole key
+	hashTag   consistent.TagFunc
+	refresher *refresher  // nil if refresh-ahead is disabled
+	retry     RetryPolicy // retries failed getter calls
+	breaker   *breaker    // nil if the circuit breaker is disabled
+	observers []GroupObserver
+	tagger    Tagger // nil if values are not tagged
+	setter    Setter // nil if the group is read only
+	writeOpts WriteOptions
+	writer    *writeBehind // nil unless in write-behind mode
+	leases    *leaseTable  // leases granted as the owner of keys
+
+	mu      sync.RWMutex // guards cfg and limiter, which can change live
+	cfg     Config
+	limiter *limiter // nil if getter loads are unlimited
 
 	// loader ensures each key is only fetched once,
 	// regardless of the number of concurrent callers.
-	loader *singleflight.Group
+	loader *singleflight.Group[string, ByteView]
+
+	// Stats are statistics on the group.
+	Stats Stats
 }
 
 // Get get value from cache, if failed then get from peers,
 // if failed then get from db locally
 func (g *Group) Get(k string) (ByteView, error) {
+	return g.GetContext(context.Background(), k)
+}
+
+// GetContext is like Get, but returns ctx's error once ctx is done.
+// The load is shared with other callers, so it goes on after ctx is
+// canceled, but not after ctx's deadline. A getter calling
+// GetContext with its ctx gets *ErrLoadCycle instead of waiting
+// for a load it depends on, see ContextGetter.
+func (g *Group) GetContext(ctx context.Context, k string) (ByteView, error) {
 	if k == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.Stats.Gets.Add(1)
 
 	if v, ok := g.mainCache.get(k); ok {
+		g.Stats.CacheHits.Add(1)
+		for _, o := range g.observers {
+			o.OnHit(k)
+		}
+		if g.refresher != nil && g.refresher.hit(k, v, time.Now()) {
+			go g.refresh(k)
+		}
 		return v, nil
 	}
-	return g.load(k)
+	for _, o := range g.observers {
+		o.OnMiss(k)
+	}
+	ctx, err := withLoad(ctx, g.name, k)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return g.load(ctx, k)
+}
+
+// refresh reloads k in background before it expires,
+// sharing the load with concurrent callers
+func (g *Group) refresh(k string) {
+	defer g.refresher.done(k)
+	_, err, _ := g.loader.Do(k, func() (ByteView, error) {
+		defer g.recordPanic(k)
+		ctx, _ := withLoad(context.Background(), g.name, k)
+		return g.getLocally(ctx, k)
+	})
+	if err != nil {
+		log.Println("[MyCache] Failed to refresh:", err)
+	}
 }
 
 // load loads k either by sending it to a peer or
 // invoking getter locally
-func (g *Group) load(k string) (v ByteView, err error) {
-	view, err := g.loader.Do(k, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.Pick(k); ok {
-				if v, err = g.getFromPeer(peer, k); err == nil {
-					return v, nil
-				}
-				log.Println("[MyCache] Failed to get from peer:", err)
-			}
+func (g *Group) load(ctx context.Context, k string) (ByteView, error) {
+	view, err, _ := g.loader.DoContext(ctx, k, func() (ByteView, error) {
+		defer g.recordPanic(k)
+		// a canceled caller leaves early, the load goes on for the
+		// others until the first caller's deadline
+		shared, cancel := detach(ctx)
+		defer cancel()
+		shared, local := forwarded(shared)
+		start := time.Now()
+		v, err := g.loadOnce(shared, k, local)
+		for _, o := range g.observers {
+			o.OnLoad(k, time.Since(start), err)
 		}
-		return g.getLocally(k)
+		return v, err
 	})
+	return view, err
+}
 
-	if err != nil {
-		return
+// sharedErr tells whether err of a load may be given to the callers
+// in the dedupe window, shedding is about the load of the moment
+func sharedErr(err error) bool {
+	var oe *OverloadError
+	return !errors.As(err, &oe)
+}
+
+// recordPanic logs and counts a panic in the load of k, then
+// panics again for loader to turn it into an error of all callers
+func (g *Group) recordPanic(k string) {
+	if r := recover(); r != nil {
+		g.Stats.LoadPanics.Add(1)
+		log.Printf("[MyCache] Load of %s panicked: %v\n%s", k, r, debug.Stack())
+		panic(r)
+	}
+}
+
+// loadOnce is the load shared by concurrent callers of k,
+// local for a load forwarded by a peer
+func (g *Group) loadOnce(ctx context.Context, k string, local bool) (ByteView, error) {
+	// a value set here is newer than the owner's, see SetContext
+	if byts, ok := g.dirty(k); ok {
+		return g.populate(k, byts), nil
 	}
-	return view.(ByteView), nil
+	if g.peers != nil && !local {
+		if peer, ok := g.peers.Pick(g.pickKey(k)); ok {
+			v, err := g.getFromPeer(peer, k)
+			if err == nil {
+				g.Stats.PeerLoads.Add(1)
+				return v, nil
+			}
+			g.Stats.PeerErrors.Add(1)
+			// back off instead of loading an overloaded peer's key
+			var oe *OverloadError
+			if errors.As(err, &oe) {
+				return ByteView{}, err
+			}
+			log.Println("[MyCache] Failed to get from peer:", err)
+			return g.loadWithLease(ctx, k)
+		}
+		if c, ok := g.peers.(localLoadCounter); ok {
+			defer c.localDone()
+		}
+	}
+	return g.getLocally(ctx, k)
 }
 
 // getLocally gets value identified by k from local db
-func (g *Group) getLocally(k string) (ByteView, error) {
-	byts, err := g.getter.Get(k)
+func (g *Group) getLocally(ctx context.Context, k string) (ByteView, error) {
+	g.mu.RLock()
+	l := g.limiter
+	g.mu.RUnlock()
+	if l != nil {
+		ok, err := l.acquire(ctx)
+		if err != nil {
+			return ByteView{}, err
+		}
+		if !ok {
+			g.Stats.LoadsShed.Add(1)
+			return ByteView{}, &OverloadError{Group: g.name}
+		}
+		defer l.release()
+	}
+
+	// the datasource is stale until dirty values are written back
+	if byts, ok := g.dirty(k); ok {
+		return g.populate(k, byts), nil
+	}
+
+	byts, err := g.getFromGetter(ctx, k)
 	if err != nil {
 		return ByteView{}, err
 	}
+	g.Stats.LocalLoads.Add(1)
+	return g.populate(k, byts), nil
+}
+
+// populate adds the value of k to mainCache
+func (g *Group) populate(k string, byts []byte) ByteView {
 	v := ByteView{bs: clone(byts)}
+	g.mu.RLock()
+	ttl := g.cfg.TTL
+	g.mu.RUnlock()
+	if ttl > 0 {
+		v.e = time.Now().Add(ttl)
+	}
+
+	var tags []string
+	if g.tagger != nil {
+		tags = g.tagger.Tags(k, byts)
+	}
+	g.mainCache.add(k, v, tags...)
+	for _, o := range g.observers {
+		o.OnSet(k, v)
+	}
+	if g.refresher != nil {
+		g.refresher.forget(k)
+	}
+	return v
+}
+
+// getFromGetter calls getter, a failed call is retried with
+// backoff until the attempts run out or the deadline of ctx comes
+func (g *Group) getFromGetter(ctx context.Context, k string) ([]byte, error) {
+	var byts []byte
+	calls := 0
+	err := g.retry.do(ctx, func() error {
+		if calls > 0 {
+			g.Stats.Retries.Add(1)
+		}
+		calls++
+		var err error
+		byts, err = g.callBreaker(ctx, k)
+		if err == nil {
+			return nil
+		}
+		// a cycle is a bug of getters, not a failure of the datasource
+		var cycle *ErrLoadCycle
+		if err == ErrCircuitOpen || errors.As(err, &cycle) {
+			return permanent{err}
+		}
+		g.Stats.LocalLoadErrs.Add(1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return byts, nil
+}
+
+// callBreaker calls getter through the breaker. A call which tells
+// nothing of the datasource, a load cycle or a panic, isn't counted,
+// but still lets the next probe of a half-open breaker through.
+func (g *Group) callBreaker(ctx context.Context, k string) ([]byte, error) {
+	if g.breaker == nil {
+		return g.callGetter(ctx, k)
+	}
+	if !g.breaker.allow(time.Now()) {
+		g.Stats.BreakerRejects.Add(1)
+		return nil, ErrCircuitOpen
+	}
+	recorded := false
+	defer func() {
+		if !recorded {
+			g.breaker.cancel()
+		}
+	}()
+
+	byts, err := g.callGetter(ctx, k)
+	var cycle *ErrLoadCycle
+	if errors.As(err, &cycle) {
+		return nil, err
+	}
+	g.breaker.record(err == nil, time.Now())
+	recorded = true
+	return byts, err
+}
+
+// callGetter passes ctx to getter if it's a ContextGetter
+func (g *Group) callGetter(ctx context.Context, k string) ([]byte, error) {
+	if cg, ok := g.getter.(ContextGetter); ok {
+		return cg.GetContext(ctx, k)
+	}
+	return g.getter.Get(k)
+}
+
+// SetTTL sets how long a loaded value lives in cache,
+// zero means never expire
+func (g *Group) SetTTL(ttl time.Duration) {
+	g.mu.Lock()
+	g.cfg.TTL = ttl
+	g.mu.Unlock()
+}
+
+// EnableRefresh reloads hot keys in background before they expire,
+// it only works with a TTL. It should be called before serving.
+func (g *Group) EnableRefresh(opts RefreshOptions) {
+	g.refresher = newRefresher(opts)
+}
+
+// SetRetryPolicy sets how failed getter calls are retried.
+// It should be called before serving.
+func (g *Group) SetRetryPolicy(p RetryPolicy) {
+	g.retry = p
+}
+
+// EnableBreaker fails loads fast with ErrCircuitOpen once the getter's
+// error rate crosses the threshold. It should be called before serving.
+func (g *Group) EnableBreaker(opts BreakerOptions) {
+	g.breaker = newBreaker(opts, &g.Stats)
+}
+
+// EnableLoadLimit bounds the getter loads in flight, loads beyond
+// the wait queue fail with *OverloadError
+func (g *Group) EnableLoadLimit(opts LimitOptions) {
+	g.mu.Lock()
+	g.setLimit(opts)
+	g.mu.Unlock()
+}
+
+// setLimit replaces the limiter, loads holding a slot of the
+// old one release it there. g.mu must be held.
+func (g *Group) setLimit(opts LimitOptions) {
+	g.cfg.Limit = opts
+	g.limiter = nil
+	if opts.MaxInFlight > 0 {
+		g.limiter = newLimiter(opts)
+	}
+}
+
+// RegisterObserver adds o to be notified of the group's cache
+// events. It should be called before serving.
+func (g *Group) RegisterObserver(o GroupObserver) {
+	g.observers = append(g.observers, o)
+}
 
-	g.mainCache.add(k, v)
-	return v, nil
+// BreakerState returns the state of the group's circuit breaker
+func (g *Group) BreakerState() BreakerState {
+	return BreakerState(g.Stats.BreakerState.Get())
+}
+
+// onEvict is called when k is dropped from mainCache
+func (g *Group) onEvict(k string, v ByteView, reason EvictReason) {
+	if g.refresher != nil {
+		g.refresher.forget(k)
+	}
+	if reason == EvictInvalidated {
+		g.loader.Forget(k) // don't serve it from the dedupe window
+	}
+	for _, o := range g.observers {
+		o.OnEvict(k, reason)
+	}
+}
+
+// SetHashTag makes peers picked by the part of keys fn returns, e.g.
+// consistent.HashTag, so related keys are on the same peer.
+// It should be called before serving.
+func (g *Group) SetHashTag(fn consistent.TagFunc) {
+	g.hashTag = fn
+}
+
+// pickKey returns the key to pick the peer of k by
+func (g *Group) pickKey(k string) string {
+	if g.hashTag != nil {
+		return g.hashTag(k)
+	}
+	return k
 }
 
 func (g *Group) RegisterPeers(peers PeerPicker) {
@@ -98,7 +395,11 @@ func (g *Group) getFromPeer(peer Peer, key string) (ByteView, error) {
 		Key:   key,
 	}
 	res := &pb.Response{}
+	start := time.Now()
 	err := peer.Fetch(req, res)
+	for _, o := range g.observers {
+		o.OnPeerFetch(peer, key, time.Since(start), err)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
@@ -116,8 +417,12 @@ func NewGroup(name string, maxBytes int64, getter Getter) *Group {
 		name:      name,
 		getter:    getter,
 		mainCache: cache{maxBytes: maxBytes},
-		loader:    &singleflight.Group{},
+		loader:    &singleflight.Group[string, ByteView]{},
+		leases:    newLeaseTable(defaultLeaseTTL),
+		cfg:       Config{MaxBytes: maxBytes, Eviction: EvictionLRU},
 	}
+	g.mainCache.onEvict = g.onEvict
+	g.loader.SetKeep(sharedErr)
 	groups[name] = g
 	return g
 }
@@ -130,3 +435,25 @@ func GetGroup(name string) *Group {
 	mu.RUnlock()
 	return g
 }
+
+// detachedContext keeps the values of its parent, e.g. the load
+// chain, but is never canceled and has no deadline
+type detachedContext struct {
+	parent context.Context
+}
+
+// detach returns ctx for a load shared by other callers, who
+// shouldn't see the cancellation of the first one. The load still
+// ends at ctx's deadline, so it doesn't outlive all of its callers
+// with retries.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detachedContext{parent: ctx}, deadline)
+	}
+	return detachedContext{parent: ctx}, func() {}
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -1,10 +1,16 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github/mycache/consistent"
+	"github/mycache/singleflight"
 	"log"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -52,3 +58,239 @@ func TestGet(t *testing.T) {
 		t.Fatalf("should be empty, but got %s", view)
 	}
 }
+
+func TestTTL(t *testing.T) {
+	var loads int32
+	g := NewGroup("ttl", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(k), nil
+		}))
+	g.SetTTL(20 * time.Millisecond)
+
+	g.Get("Tom")
+	g.Get("Tom")
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("should load once before expiring, got %d", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g.Get("Tom")
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("should reload after expiring, got %d", n)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads int32
+	g := NewGroup("refresh", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(k), nil
+		}))
+	g.SetTTL(50 * time.Millisecond)
+	g.EnableRefresh(RefreshOptions{Ahead: 40 * time.Millisecond, MinHits: 2})
+
+	g.Get("hot")
+	g.Get("cold")
+	time.Sleep(20 * time.Millisecond)
+
+	// hot is hit twice inside the refresh window, cold only once
+	g.Get("hot")
+	g.Get("hot")
+	g.Get("cold")
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&loads); n != 3 {
+		t.Fatalf("should refresh hot key only, got %d loads", n)
+	}
+
+	// the refreshed hot key outlives the original TTL
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := g.mainCache.get("hot"); !ok {
+		t.Fatalf("hot key should be refreshed before expiring")
+	}
+	if _, ok := g.mainCache.get("cold"); ok {
+		t.Fatalf("cold key should expire")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	g := NewGroup("retry", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return nil, fmt.Errorf("db is flapping")
+			}
+			return []byte(k), nil
+		}))
+	g.SetRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond})
+
+	if view, err := g.Get("Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("should succeed on the third call, got %v", err)
+	}
+	if n := g.Stats.Retries.Get(); n != 2 {
+		t.Fatalf("should retry twice, got %d", n)
+	}
+
+	// no retry when the deadline is too close
+	atomic.StoreInt32(&calls, 0)
+	g.SetRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "Sam"); err == nil {
+		t.Fatalf("should give up before the deadline")
+	}
+	// the shared load gives up too, instead of retrying in background
+	select {
+	case res := <-g.loader.DoChan("Sam", func() (ByteView, error) { return ByteView{}, nil }):
+		if res.Shared {
+			t.Fatalf("load of Sam should be done")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("load of Sam should be done")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("getter should be called once, got %d", n)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	g := NewGroup("breaker", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, fmt.Errorf("db is down")
+		}))
+	g.EnableBreaker(BreakerOptions{
+		Window: time.Minute, MinRequests: 2, Threshold: 1, Cooldown: time.Minute,
+	})
+
+	g.Get("a")
+	g.Get("b")
+	if g.BreakerState() != BreakerOpen {
+		t.Fatalf("breaker should open, got %v", g.BreakerState())
+	}
+	if _, err := g.Get("c"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("should fail fast, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("getter should not be called when open, got %d calls", n)
+	}
+}
+
+func TestLoadLimit(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("limit", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			<-release
+			return []byte(k), nil
+		}))
+	g.EnableLoadLimit(LimitOptions{MaxInFlight: 1, MaxQueue: 1})
+
+	errs := make(chan error, 2)
+	go func() { _, err := g.Get("a"); errs <- err }()
+	time.Sleep(10 * time.Millisecond)
+	go func() { _, err := g.Get("b"); errs <- err }() // waits in queue
+	time.Sleep(10 * time.Millisecond)
+
+	var oe *OverloadError
+	if _, err := g.Get("c"); !errors.As(err, &oe) {
+		t.Fatalf("should be shed when queue is full, got %v", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("in flight and queued loads should succeed, got %v", err)
+		}
+	}
+	if n := g.Stats.LoadsShed.Get(); n != 1 {
+		t.Fatalf("should shed 1 load, got %d", n)
+	}
+}
+
+func TestLoadPanic(t *testing.T) {
+	g := NewGroup("panic", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			if k == "bad" {
+				panic("getter is broken")
+			}
+			return []byte(k), nil
+		}))
+
+	var pe *singleflight.PanicError
+	if _, err := g.Get("bad"); !errors.As(err, &pe) {
+		t.Fatalf("panic should turn into an error, got %v", err)
+	}
+	if _, err := g.Get("bad"); !errors.As(err, &pe) {
+		t.Fatalf("key should be loaded again after panic, got %v", err)
+	}
+	if n := g.Stats.LoadPanics.Get(); n != 2 {
+		t.Fatalf("should count 2 panics, got %d", n)
+	}
+}
+
+func TestLoadLeaderCanceled(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("leader-canceled", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, k string) ([]byte, error) {
+			<-release
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return []byte(k), nil
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, err := g.GetContext(ctx, "Tom")
+		leader <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	waiter := make(chan error)
+	go func() {
+		_, err := g.Get("Tom")
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the leader leaves, the load goes on for the waiter
+	cancel()
+	if err := <-leader; err != context.Canceled {
+		t.Fatalf("canceled leader should get its error, got %v", err)
+	}
+	close(release)
+	if err := <-waiter; err != nil {
+		t.Fatalf("waiter should get the value, got %v", err)
+	}
+}
+
+// keyPicker records the keys picked, and leaves them all to self
+type keyPicker struct {
+	keys []string
+}
+
+func (p *keyPicker) Pick(key string) (Peer, bool) {
+	p.keys = append(p.keys, key)
+	return nil, false
+}
+func (p *keyPicker) PickN(key string, n int) []Peer { return nil }
+func (p *keyPicker) Peers() []Peer                  { return nil }
+
+func TestGroupHashTag(t *testing.T) {
+	g := NewGroup("hash-tag", 2<<10, GetterFunc(func(k string) ([]byte, error) {
+		return []byte(k), nil
+	}))
+	picker := &keyPicker{}
+	g.RegisterPeers(picker)
+	g.SetHashTag(consistent.HashTag)
+
+	for _, k := range []string{"{user42}:profile", "{user42}:prefs", "plain"} {
+		if v, err := g.Get(k); err != nil || v.String() != k {
+			t.Fatalf("Get(%s) = %v, %v", k, v, err)
+		}
+	}
+	if !reflect.DeepEqual(picker.keys, []string{"user42", "user42", "plain"}) {
+		t.Fatalf("peers should be picked by hash tags, got %v", picker.keys)
+	}
+}
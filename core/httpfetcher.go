@@ -1,26 +1,61 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github/mycache/pb"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 )
 
+// forwardedHeader marks a fetch from a peer, the receiver loads
+// the key itself instead of picking a peer again. Otherwise a key
+// moved off a full owner by bounded load would go back to it, or
+// bounce between nodes seeing different loads.
+const forwardedHeader = "X-Mycache-Forwarded"
+
 type httpFetcher struct {
-	baseURL string
+	baseURL  string
+	inFlight int64 // fetches in flight, atomic
+}
+
+// ping tells whether the peer is serving, any response will do
+func (h *httpFetcher) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
 }
 
 func (h *httpFetcher) Fetch(in *pb.Request, out *pb.Response) error {
+	atomic.AddInt64(&h.inFlight, 1)
+	defer atomic.AddInt64(&h.inFlight, -1)
+
 	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.Group), url.QueryEscape(in.Key))
-	res, err := http.Get(u)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(forwardedHeader, "1")
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusTooManyRequests {
+		return &OverloadError{Group: in.Group, Peer: h.baseURL}
+	}
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("server returns: %v", res.Status)
 	}
@@ -35,4 +70,55 @@ func (h *httpFetcher) Fetch(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
+func (h *httpFetcher) Invalidate(in *pb.InvalidateRequest, out *pb.InvalidateResponse) error {
+	u := fmt.Sprintf("%v%v/", h.baseURL, url.QueryEscape(in.Group))
+	return h.call(http.MethodDelete, u, in, out)
+}
+
+func (h *httpFetcher) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	u := fmt.Sprintf("%v%v/%v?lease=acquire", h.baseURL, url.QueryEscape(in.Group), url.QueryEscape(in.Key))
+	return h.call(http.MethodPost, u, in, out)
+}
+
+func (h *httpFetcher) Release(in *pb.ReleaseRequest, out *pb.ReleaseResponse) error {
+	u := fmt.Sprintf("%v%v/%v?lease=release", h.baseURL, url.QueryEscape(in.Group), url.QueryEscape(in.Key))
+	return h.call(http.MethodPost, u, in, out)
+}
+
+// call sends in as the body of a method request to u,
+// and decodes the response body to out
+func (h *httpFetcher) call(method, u string, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding rpc request body err: %v", err)
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returns: %v", res.Status)
+	}
+
+	byts, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading http response body err: %v", err)
+	}
+	if err := proto.Unmarshal(byts, out); err != nil {
+		return fmt.Errorf("decoding rpc response body err: %v", err)
+	}
+	return nil
+}
+
+func (h *httpFetcher) String() string {
+	return h.baseURL
+}
+
 var _ Peer = (*httpFetcher)(nil)
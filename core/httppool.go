@@ -1,19 +1,27 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github/mycache/consistent"
 	"github/mycache/pb"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_mycache/"
 	defaultReplicas = 50
+
+	peerPingDelay    = 100 * time.Millisecond // first delay of WaitPeers
+	maxPeerPingDelay = 2 * time.Second
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
@@ -23,14 +31,34 @@ type HTTPPool struct {
 	// http://xx.com/_mycache/ serves as the default prefix.
 	basePath     string
 	mu           sync.Mutex
-	peers        *consistent.Map
-	httpFetchers map[string]*httpFetcher // get key by url, eg. "http://localhost:8080"
+	peers        consistent.Placement
+	weights      map[string]int               // weight of each peer
+	labels       map[string]consistent.Labels // failure domain of each peer
+	httpFetchers map[string]*httpFetcher      // get key by url, eg. "http://localhost:8080"
+	epsilon      float64                      // bound of loads over the average, 0 if unbounded
+	localLoads   int64                        // loads left to self in flight, atomic
+	zoneReplicas int                          // replicas to read from in self's zone, 0 if disabled
+}
+
+// labeledPlacement is a Placement which spreads replicas over
+// failure domains
+type labeledPlacement interface {
+	SetLabels(node string, labels consistent.Labels)
+}
+
+// boundedPlacement is a Placement which can bound the loads of nodes
+type boundedPlacement interface {
+	LocateBounded(k string, loads map[string]int, epsilon float64) string
 }
 
 func NewHTTPPool(self string) *HTTPPool {
 	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+		self:         self,
+		basePath:     defaultBasePath,
+		peers:        consistent.New(defaultReplicas, nil),
+		weights:      make(map[string]int),
+		labels:       make(map[string]consistent.Labels),
+		httpFetchers: make(map[string]*httpFetcher),
 	}
 }
 
@@ -61,7 +89,31 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
+	if r.Method == http.MethodDelete {
+		p.serveInvalidate(w, r, group)
+		return
+	}
+	if r.Method == http.MethodPost {
+		p.serveLease(w, r, group, key)
+		return
+	}
+
+	ctx := r.Context()
+	if r.Header.Get(forwardedHeader) != "" {
+		ctx = withoutPeers(ctx)
+	}
+	view, err := group.GetContext(ctx, key)
+	var oe *OverloadError
+	if errors.As(err, &oe) {
+		// let the calling peer back off
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -76,28 +128,289 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(byts)
 }
 
-// Set sets the pool's list of peers(url), discards the old ones
+// serveInvalidate drops the entries of group on this node
+func (p *HTTPPool) serveInvalidate(w http.ResponseWriter, r *http.Request, group *Group) {
+	byts, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.InvalidateRequest{}
+	if err := proto.Unmarshal(byts, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	removed := group.invalidateLocally(req)
+	byts, err = proto.Marshal(&pb.InvalidateResponse{Removed: int64(removed)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(byts)
+}
+
+// serveLease acquires or releases the lease of key, as its owner
+func (p *HTTPPool) serveLease(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	byts, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res proto.Message
+	switch r.URL.Query().Get("lease") {
+	case "acquire":
+		if res, err = group.acquireLease(r.Context(), key); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	case "release":
+		req := &pb.ReleaseRequest{}
+		if err := proto.Unmarshal(byts, req); err != nil || req.Key != key {
+			http.Error(w, "bad release request", http.StatusBadRequest)
+			return
+		}
+		group.releaseLease(req)
+		res = &pb.ReleaseResponse{}
+	default:
+		http.Error(w, "bad request, lease should be acquire or release", http.StatusBadRequest)
+		return
+	}
+
+	if byts, err = proto.Marshal(res); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(byts)
+}
+
+// Set sets the pool's list of peers(url), all of weight 1
 func (p *HTTPPool) Set(peers ...string) {
+	weights := make(map[string]int, len(peers))
+	for _, peer := range peers {
+		weights[peer] = 1
+	}
+	p.SetWeighted(weights) // weights of 1 are valid
+}
+
+// SetWeighted sets the pool's peers(url) with their weights, a peer's
+// share of keys scales with its weight. Only the difference is
+// applied to the ring, peers kept in the list keep their fetchers.
+// Weights must be positive, or nothing is changed.
+func (p *HTTPPool) SetWeighted(peers map[string]int) error {
+	for peer, weight := range peers {
+		if weight <= 0 {
+			return fmt.Errorf("weight of peer %s should be positive, got %d", peer, weight)
+		}
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.peers = consistent.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpFetchers = make(map[string]*httpFetcher, len(peers))
-	for _, peer := range peers {
-		p.httpFetchers[peer] = &httpFetcher{baseURL: peer + p.basePath}
+	for peer := range p.httpFetchers {
+		if _, ok := peers[peer]; !ok {
+			p.peers.Remove(peer)
+			delete(p.weights, peer)
+			delete(p.httpFetchers, peer)
+		}
+	}
+	for peer, weight := range peers {
+		p.peers.AddWeighted(peer, weight)
+		p.weights[peer] = weight
+		if _, ok := p.httpFetchers[peer]; !ok {
+			p.httpFetchers[peer] = &httpFetcher{baseURL: peer + p.basePath}
+		}
+	}
+	return nil
+}
+
+// SetPlacement replaces how keys are placed on peers, the vnode ring
+// by default. The current peers are moved to placement.
+func (p *HTTPPool) SetPlacement(placement consistent.Placement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for peer, weight := range p.weights {
+		placement.AddWeighted(peer, weight)
+	}
+	if l, ok := placement.(labeledPlacement); ok {
+		for peer, labels := range p.labels {
+			l.SetLabels(peer, labels)
+		}
+	}
+	p.peers = placement
+}
+
+// SetLabels sets the failure domains of peers(url), self included,
+// replacing the old ones. Replicas of PickN are spread over them,
+// if the placement supports labels, e.g. the vnode ring.
+func (p *HTTPPool) SetLabels(labels map[string]consistent.Labels) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.peers.(labeledPlacement)
+	for peer := range p.labels {
+		if _, keep := labels[peer]; !keep && ok {
+			l.SetLabels(peer, consistent.Labels{})
+		}
+	}
+	p.labels = make(map[string]consistent.Labels, len(labels))
+	for peer, labels := range labels {
+		p.labels[peer] = labels
+		if ok {
+			l.SetLabels(peer, labels)
+		}
 	}
 }
 
+// EnableZoneReads makes Pick prefer the first of the n owners of a key
+// in self's zone, so reads stay in the zone, or the primary if there's
+// none. A replica missing the key loads it as for its own reads.
+// If the read fails, the lease to load it is still asked of the ring
+// owners, see PickN. It takes precedence over bounded load.
+func (p *HTTPPool) EnableZoneReads(n int) {
+	p.mu.Lock()
+	p.zoneReplicas = n
+	p.mu.Unlock()
+}
+
+// SetSeed places keys on a ring hashed with seed, see
+// consistent.SeededHash64. All nodes should share the same seed,
+// kept secret, so keys can't be aimed at one node from outside.
+// It replaces the placement set by SetPlacement, and is replaced by a
+// later one. To seed another placement, give it consistent.SeededHash:
+//
+//	p.SetPlacement(consistent.NewRendezvous(consistent.SeededHash(seed)))
+func (p *HTTPPool) SetSeed(seed []byte) {
+	p.SetPlacement(consistent.New64(defaultReplicas, consistent.SeededHash64(seed)))
+}
+
+// Shares returns the expected share of keys of each peer, self included
+func (p *HTTPPool) Shares() map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers.Shares()
+}
+
+// EnableBoundedLoad caps the loads in flight of each peer at (1+epsilon)
+// times its share of all, keys of a full peer go to the next one on the
+// ring. The loads are counted on this node, as the fetches in flight to
+// each peer and the local loads. It only works with the vnode ring.
+func (p *HTTPPool) EnableBoundedLoad(epsilon float64) {
+	p.mu.Lock()
+	p.epsilon = epsilon
+	p.mu.Unlock()
+}
+
 func (p *HTTPPool) Pick(key string) (Peer, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if peer := p.peers.Locate(key); peer != "" && peer != p.self {
+	peer := p.locate(key)
+	if peer != "" && peer != p.self {
 		p.Log("Pick peer %s", peer)
 		return p.httpFetchers[peer], true
 	}
+	atomic.AddInt64(&p.localLoads, 1)
 	return nil, false
 }
 
+func (p *HTTPPool) PickN(key string, n int) []Peer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var peers []Peer
+	for _, peer := range p.peers.LocateN(key, n) {
+		if peer == p.self {
+			peers = append(peers, nil)
+		} else {
+			peers = append(peers, p.httpFetchers[peer])
+		}
+	}
+	return peers
+}
+
+// locate returns the node to load key from. p.mu must be held.
+func (p *HTTPPool) locate(key string) string {
+	if zone := p.labels[p.self].Zone; p.zoneReplicas > 0 && zone != "" {
+		for _, owner := range p.peers.LocateN(key, p.zoneReplicas) {
+			if p.labels[owner].Zone == zone {
+				return owner
+			}
+		}
+	}
+	if b, ok := p.peers.(boundedPlacement); ok && p.epsilon > 0 {
+		return b.LocateBounded(key, p.loads(), p.epsilon)
+	}
+	return p.peers.Locate(key)
+}
+
+// loads returns the loads in flight of each peer. p.mu must be held.
+func (p *HTTPPool) loads() map[string]int {
+	loads := make(map[string]int, len(p.httpFetchers)+1)
+	for peer, fetcher := range p.httpFetchers {
+		loads[peer] = int(atomic.LoadInt64(&fetcher.inFlight))
+	}
+	loads[p.self] = int(atomic.LoadInt64(&p.localLoads))
+	return loads
+}
+
+// localDone is called by Group when a load left to self by Pick ends
+func (p *HTTPPool) localDone() {
+	atomic.AddInt64(&p.localLoads, -1)
+}
+
+// Peers returns all the peers but self
+func (p *HTTPPool) Peers() []Peer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]Peer, 0, len(p.httpFetchers))
+	for peer, fetcher := range p.httpFetchers {
+		if peer != p.self {
+			peers = append(peers, fetcher)
+		}
+	}
+	return peers
+}
+
+// WaitPeers waits until all peers are serving, e.g. to warm up once
+// keys can be fetched from their owners. It returns ctx's error if
+// some peer is still down when ctx is done.
+func (p *HTTPPool) WaitPeers(ctx context.Context) error {
+	p.mu.Lock()
+	var down []*httpFetcher
+	for peer, fetcher := range p.httpFetchers {
+		if peer != p.self {
+			down = append(down, fetcher)
+		}
+	}
+	p.mu.Unlock()
+
+	delay := peerPingDelay
+	for {
+		for i := 0; i < len(down); {
+			if down[i].ping(ctx) == nil {
+				down = append(down[:i], down[i+1:]...)
+				continue
+			}
+			i++
+		}
+		if len(down) == 0 {
+			return nil
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if delay *= 2; delay > maxPeerPingDelay {
+			delay = maxPeerPingDelay
+		}
+	}
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
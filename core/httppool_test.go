@@ -1,10 +1,18 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"github/mycache/consistent"
+	"github/mycache/pb"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestHTTPPool(t *testing.T) {
@@ -23,3 +31,264 @@ func TestHTTPPool(t *testing.T) {
 
 	http.ListenAndServe(addr, peers)
 }
+
+func TestHTTPPoolSet(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.Set("http://a", "http://b", "http://c")
+	b := p.httpFetchers["http://b"]
+
+	p.Set("http://a", "http://b", "http://d")
+	if p.httpFetchers["http://b"] != b {
+		t.Fatalf("unchanged peer should keep its fetcher")
+	}
+	if _, ok := p.httpFetchers["http://c"]; ok || p.peers.Has("http://c") {
+		t.Fatalf("removed peer should be dropped")
+	}
+	if nodes := p.peers.Nodes(); !reflect.DeepEqual(nodes, []string{"http://a", "http://b", "http://d"}) {
+		t.Fatalf("ring should have the new peers, got %v", nodes)
+	}
+	if len(p.Peers()) != 2 {
+		t.Fatalf("Peers should exclude self, got %v", p.Peers())
+	}
+}
+
+func TestHTTPPoolSetWeighted(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.SetWeighted(map[string]int{"http://a": 1, "http://b": 3})
+	b := p.httpFetchers["http://b"]
+
+	if err := p.SetWeighted(map[string]int{"http://a": 1, "http://b": 0}); err == nil || p.weights["http://b"] != 3 {
+		t.Fatalf("zero weight should be rejected without a change, got %v", err)
+	}
+	p.SetWeighted(map[string]int{"http://a": 1, "http://b": 1})
+	if p.httpFetchers["http://b"] != b {
+		t.Fatalf("reweighted peer should keep its fetcher")
+	}
+	shares := p.Shares()
+	if len(shares) != 2 || shares["http://a"] < 0.3 || shares["http://b"] < 0.3 {
+		t.Fatalf("equal peers should share keys about evenly, got %v", shares)
+	}
+}
+
+func TestHTTPPoolSetPlacement(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.SetWeighted(map[string]int{"http://a": 1, "http://b": 3})
+	p.SetPlacement(consistent.NewRendezvous(nil))
+
+	if shares := p.Shares(); shares["http://b"] != 0.75 {
+		t.Fatalf("peers should be moved with their weights, got %v", shares)
+	}
+	p.Set("http://a", "http://c")
+	if nodes := p.peers.Nodes(); !reflect.DeepEqual(nodes, []string{"http://a", "http://c"}) {
+		t.Fatalf("placement should have the new peers, got %v", nodes)
+	}
+}
+
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.Set("http://a", "http://b", "http://c")
+	p.EnableBoundedLoad(0.25)
+
+	var k string
+	for i := 0; ; i++ {
+		k = fmt.Sprint("key", i)
+		peer, ok := p.Pick(k)
+		if !ok {
+			p.localDone()
+		} else if peer.(*httpFetcher).baseURL == "http://b"+defaultBasePath {
+			break
+		}
+	}
+
+	p.httpFetchers["http://b"].inFlight = 10
+	peer, ok := p.Pick(k)
+	if ok && peer.(*httpFetcher).baseURL == "http://b"+defaultBasePath {
+		t.Fatalf("key should move off the busy peer")
+	}
+	if !ok {
+		p.localDone()
+	}
+	if p.localLoads != 0 {
+		t.Fatalf("local loads should be done, got %d", p.localLoads)
+	}
+}
+
+func TestHTTPPoolPickN(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.Set("http://a", "http://b", "http://c")
+
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprint("key", i)
+		peers := p.PickN(k, 3)
+		self := 0
+		for _, peer := range peers {
+			if peer == nil {
+				self++
+			}
+		}
+		if len(peers) != 3 || self != 1 {
+			t.Fatalf("all peers should be picked, self as nil, got %v", peers)
+		}
+		if peer, ok := p.Pick(k); ok && peer != peers[0] {
+			t.Fatalf("the primary should be picked first, got %v", peers)
+		} else if !ok {
+			p.localDone()
+			if peers[0] != nil {
+				t.Fatalf("self should be the primary, got %v", peers)
+			}
+		}
+	}
+}
+
+func TestHTTPPoolSetSeed(t *testing.T) {
+	a, b := NewHTTPPool("http://a"), NewHTTPPool("http://b")
+	for _, p := range []*HTTPPool{a, b} {
+		p.SetSeed([]byte("secret"))
+		p.Set("http://a", "http://b", "http://c")
+	}
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprint("key", i)
+		if a.peers.Locate(k) != b.peers.Locate(k) {
+			t.Fatalf("nodes sharing the seed should agree on the owner of %s", k)
+		}
+	}
+}
+
+func TestHTTPPoolZoneReads(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.Set("http://a", "http://b", "http://c")
+	p.SetLabels(map[string]consistent.Labels{
+		"http://a": {Zone: "east"},
+		"http://b": {Zone: "west"},
+		"http://c": {Zone: "west"},
+	})
+	p.EnableZoneReads(2)
+
+	for i := 0; i < 50; i++ {
+		k := fmt.Sprint("key", i)
+		owners := p.peers.LocateN(k, 2)
+		peer, ok := p.Pick(k)
+		if !ok {
+			p.localDone()
+		}
+		// a is the only node of east, one of the 2 owners
+		if owners[0] == "http://a" || owners[1] == "http://a" {
+			if ok {
+				t.Fatalf("%s should be read locally in the zone, owners %v", k, owners)
+			}
+		} else if !ok || peer.(*httpFetcher).baseURL != owners[0]+defaultBasePath {
+			t.Fatalf("%s should be read from the primary, owners %v", k, owners)
+		}
+	}
+}
+
+func TestHTTPPoolPlacementAgree(t *testing.T) {
+	placements := map[string]func() consistent.Placement{
+		"ring":       func() consistent.Placement { return consistent.New(defaultReplicas, nil) },
+		"rendezvous": func() consistent.Placement { return consistent.NewRendezvous(nil) },
+		"jump":       func() consistent.Placement { return consistent.NewJump(nil) },
+		"maglev":     func() consistent.Placement { return consistent.NewMaglev(0, nil) },
+	}
+	peers := map[string]int{"http://a": 1, "http://b": 2, "http://c": 1, "http://d": 3, "http://e": 1}
+	for name, newPlacement := range placements {
+		// one node sets the placement first, the other the peers first
+		a := NewHTTPPool("http://a")
+		a.SetPlacement(newPlacement())
+		a.SetWeighted(peers)
+		b := NewHTTPPool("http://b")
+		b.SetWeighted(peers)
+		b.SetPlacement(newPlacement())
+
+		for i := 0; i < 2000; i++ {
+			k := fmt.Sprint("key", i)
+			if a.peers.Locate(k) != b.peers.Locate(k) {
+				t.Fatalf("%s: nodes disagree on the owner of %s", name, k)
+			}
+		}
+	}
+}
+
+func TestHTTPPoolBoundedForward(t *testing.T) {
+	// c owns the key, but is full in the view of q
+	var cHits int32
+	c := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cHits, 1)
+		http.Error(w, "should not be asked", http.StatusInternalServerError)
+	}))
+	defer c.Close()
+
+	// p is not full, and c isn't either in its own view
+	g := NewGroup("bounded-forward", 2<<10, GetterFunc(func(k string) ([]byte, error) {
+		return []byte(k), nil
+	}))
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	p := NewHTTPPool(srv.URL)
+	mux.Handle(defaultBasePath, p)
+	p.Set(srv.URL, c.URL)
+	g.RegisterPeers(p)
+
+	q := NewHTTPPool("http://q")
+	q.Set(srv.URL, c.URL)
+	q.EnableBoundedLoad(0.25)
+	q.httpFetchers[c.URL].inFlight = 10
+
+	var k string
+	for i := 0; ; i++ {
+		if k = fmt.Sprint("key", i); q.peers.Locate(k) == c.URL {
+			break
+		}
+	}
+	peer, ok := q.Pick(k)
+	if !ok || peer.(*httpFetcher).baseURL != srv.URL+defaultBasePath {
+		t.Fatalf("q should move the key off c to p")
+	}
+
+	// p loads the forwarded key itself, instead of asking c
+	res := &pb.Response{}
+	if err := peer.Fetch(&pb.Request{Group: "bounded-forward", Key: k}, res); err != nil || string(res.Value) != k {
+		t.Fatalf("p should serve the key, got %q %v", res.Value, err)
+	}
+	if n := atomic.LoadInt32(&cHits); n != 0 {
+		t.Fatalf("forwarded fetch should not go back to c, got %d requests", n)
+	}
+}
+
+func TestHTTPPoolWaitPeers(t *testing.T) {
+	// a peer whose address is known, but not serving yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p := NewHTTPPool("http://self")
+	p.Set("http://self", "http://"+addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.WaitPeers(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("should wait for the down peer until the deadline, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.WaitPeers(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skip("address is taken:", err)
+	}
+	srv := httptest.NewUnstartedServer(NewHTTPPool("http://" + addr))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("should return once the peer is serving")
+	}
+}
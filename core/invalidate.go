@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"github/mycache/pb"
+	"sync"
+)
+
+// InvalidateTag drops the entries tagged with tag, on this node
+// and all the peers
+func (g *Group) InvalidateTag(tag string) error {
+	return g.invalidate(&pb.InvalidateRequest{Group: g.name, Tag: tag})
+}
+
+// InvalidatePrefix drops the entries whose key starts with prefix,
+// on this node and all the peers
+func (g *Group) InvalidatePrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("prefix is required")
+	}
+	return g.invalidate(&pb.InvalidateRequest{Group: g.name, Prefix: prefix})
+}
+
+// Keys returns at most limit keys cached on this node, which start
+// with prefix, in order. All of them are returned if limit <= 0.
+func (g *Group) Keys(prefix string, limit int) []string {
+	return g.mainCache.keysWithPrefix(prefix, limit)
+}
+
+// EnablePrefixIndex keeps an ordered index of keys next to the cache,
+// so that Keys and InvalidatePrefix don't scan all the keys
+func (g *Group) EnablePrefixIndex() {
+	g.mainCache.enableIndex()
+}
+
+// RegisterTagger tags values when they are loaded, see InvalidateTag.
+// It should be called before serving.
+func (g *Group) RegisterTagger(t Tagger) {
+	g.tagger = t
+}
+
+// invalidate applies in locally, then broadcasts it to all peers
+func (g *Group) invalidate(in *pb.InvalidateRequest) error {
+	g.invalidateLocally(in)
+	return g.broadcast(in)
+}
+
+// broadcast sends in to all peers, but not this node
+func (g *Group) broadcast(in *pb.InvalidateRequest) error {
+	if g.peers == nil {
+		return nil
+	}
+
+	peers := g.peers.Peers()
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer Peer) {
+			defer wg.Done()
+			errs[i] = peer.Invalidate(in, &pb.InvalidateResponse{})
+		}(i, peer)
+	}
+	wg.Wait()
+
+	failed := 0
+	var first error
+	for _, err := range errs {
+		if err != nil {
+			if failed++; first == nil {
+				first = err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("invalidate on %d of %d peers failed, first: %v", failed, len(peers), first)
+	}
+	return nil
+}
+
+// invalidateLocally drops entries matching in from mainCache,
+// returns how many are dropped
+func (g *Group) invalidateLocally(in *pb.InvalidateRequest) int {
+	removed := 0
+	if in.Tag != "" {
+		removed += g.mainCache.removeTag(in.Tag)
+	}
+	if in.Prefix != "" {
+		removed += g.mainCache.removePrefix(in.Prefix)
+	}
+	for _, k := range in.Keys {
+		if g.mainCache.removeKey(k) {
+			removed++
+		}
+	}
+	return removed
+}
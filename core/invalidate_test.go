@@ -0,0 +1,121 @@
+package core
+
+import (
+	"github/mycache/pb"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newTaggedGroup(name string) *Group {
+	g := NewGroup(name, 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			return []byte(k), nil
+		}))
+	// key "user:42/profile" is tagged with "user:42"
+	g.RegisterTagger(TaggerFunc(func(k string, v []byte) []string {
+		return []string{strings.SplitN(k, "/", 2)[0]}
+	}))
+	return g
+}
+
+func TestInvalidateTag(t *testing.T) {
+	g := newTaggedGroup("tagged")
+	for _, k := range []string{"user:42/profile", "user:42/prefs", "user:7/profile"} {
+		g.Get(k)
+	}
+
+	if err := g.InvalidateTag("user:42"); err != nil {
+		t.Fatal(err)
+	}
+	for k, cached := range map[string]bool{
+		"user:42/profile": false,
+		"user:42/prefs":   false,
+		"user:7/profile":  true,
+	} {
+		if _, ok := g.mainCache.get(k); ok != cached {
+			t.Errorf("%s should be cached: %v", k, cached)
+		}
+	}
+}
+
+func TestInvalidatePeer(t *testing.T) {
+	g := newTaggedGroup("tagged-peer")
+	g.Get("user:42/profile")
+	g.Get("user:7/profile")
+
+	srv := httptest.NewServer(NewHTTPPool("peer"))
+	defer srv.Close()
+	peer := &httpFetcher{baseURL: srv.URL + defaultBasePath}
+
+	res := &pb.InvalidateResponse{}
+	if err := peer.Invalidate(&pb.InvalidateRequest{Group: "tagged-peer", Tag: "user:42"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 1 {
+		t.Fatalf("peer should drop 1 entry, got %d", res.Removed)
+	}
+	if _, ok := g.mainCache.get("user:42/profile"); ok {
+		t.Fatalf("user:42/profile should be dropped")
+	}
+}
+
+func TestInvalidateBroadcast(t *testing.T) {
+	g := newTaggedGroup("tagged-broadcast")
+
+	var got int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			atomic.AddInt32(&got, 1)
+		}
+		NewHTTPPool("peer").ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	p := NewHTTPPool("http://self")
+	p.Set("http://self", srv.URL, down.URL)
+	g.RegisterPeers(p)
+
+	err := g.InvalidateTag("user:42")
+	if n := atomic.LoadInt32(&got); n != 1 {
+		t.Fatalf("peer should get the invalidation once, got %d", n)
+	}
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 peers failed") {
+		t.Fatalf("down peer should be reported, got %v", err)
+	}
+}
+
+func TestInvalidatePrefix(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		g := NewGroup("reports", 2<<10, GetterFunc(
+			func(k string) ([]byte, error) {
+				return []byte(k), nil
+			}))
+		if indexed {
+			g.EnablePrefixIndex()
+		}
+		for _, k := range []string{"report/2026/10/b", "report/2026/10/a", "report/2026/9", "user/1"} {
+			g.Get(k)
+		}
+
+		expect := []string{"report/2026/10/a", "report/2026/10/b"}
+		if keys := g.Keys("report/2026/10/", 0); !reflect.DeepEqual(keys, expect) {
+			t.Fatalf("indexed %v: expect keys %v, got %v", indexed, expect, keys)
+		}
+		if keys := g.Keys("report/", 1); !reflect.DeepEqual(keys, expect[:1]) {
+			t.Fatalf("indexed %v: expect keys %v, got %v", indexed, expect[:1], keys)
+		}
+
+		if err := g.InvalidatePrefix("report/"); err != nil {
+			t.Fatal(err)
+		}
+		if keys := g.Keys("", 0); !reflect.DeepEqual(keys, []string{"user/1"}) {
+			t.Fatalf("indexed %v: reports should be dropped, got %v", indexed, keys)
+		}
+	}
+}
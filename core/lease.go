@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github/mycache/pb"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLeaseTTL = 2 * time.Second
+	leaseOwners     = 3 // owners of a key asked for its lease in turn
+)
+
+// lease is granted by the owner of a key to one node, which loads
+// the key for the whole cluster when fetching from the owner fails
+type lease struct {
+	id      uint64
+	expires time.Time
+	done    chan struct{} // closed on release
+	value   []byte
+	err     string
+	timer   *time.Timer // drops the lease from the table on expiry
+}
+
+// leaseTable holds the leases granted by this node, as the owner
+type leaseTable struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	nextID uint64
+	leases map[string]*lease
+}
+
+func newLeaseTable(ttl time.Duration) *leaseTable {
+	return &leaseTable{ttl: ttl, leases: make(map[string]*lease)}
+}
+
+// acquire grants the lease of k if no one holds it, or waits for
+// the holder to release it or for the lease to expire. It returns
+// the granted lease, or the released one with the holder's result.
+func (t *leaseTable) acquire(ctx context.Context, k string) (*lease, bool, error) {
+	for {
+		t.mu.Lock()
+		l, ok := t.leases[k]
+		if !ok || !time.Now().Before(l.expires) {
+			t.nextID++
+			l = &lease{id: t.nextID, expires: time.Now().Add(t.ttl), done: make(chan struct{})}
+			t.leases[k] = l
+			l.timer = time.AfterFunc(t.ttl, func() { t.expire(k, l) })
+			t.mu.Unlock()
+			return l, true, nil
+		}
+		t.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(l.expires))
+		select {
+		case <-l.done:
+			timer.Stop()
+			return l, false, nil
+		case <-timer.C: // the holder is gone, take over
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// release hands the result of the lease holder to the waiters,
+// returns false if the lease has expired and may be granted again
+func (t *leaseTable) release(k string, id uint64, value []byte, err string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.leases[k]
+	if !ok || l.id != id {
+		return false
+	}
+	delete(t.leases, k)
+	l.timer.Stop()
+	l.value, l.err = value, err
+	close(l.done)
+	return true
+}
+
+// expire drops l if it's never released, e.g. its holder is gone,
+// so keys never asked again don't stay in the table
+func (t *leaseTable) expire(k string, l *lease) {
+	t.mu.Lock()
+	if t.leases[k] == l {
+		delete(t.leases, k)
+	}
+	t.mu.Unlock()
+}
+
+// loadWithLease loads k locally for the whole cluster, when fetching
+// it from its owner fails. Only the node holding the lease of k calls
+// getter, the others wait for its result. The lease is granted by the
+// first of the ring owners of k which can be reached, the same one on
+// all nodes. If none can, k is loaded locally.
+func (g *Group) loadWithLease(ctx context.Context, k string) (ByteView, error) {
+	for _, owner := range g.peers.PickN(g.pickKey(k), leaseOwners) {
+		if owner == nil { // self is the first owner reached
+			res, err := g.acquireLease(ctx, k)
+			if err != nil {
+				return ByteView{}, err
+			}
+			return g.useLease(ctx, k, res, func(req *pb.ReleaseRequest) error {
+				g.releaseLease(req)
+				return nil
+			})
+		}
+
+		res := &pb.LeaseResponse{}
+		if err := owner.Lease(&pb.LeaseRequest{Group: g.name, Key: k}, res); err != nil {
+			log.Println("[MyCache] Failed to get lease from peer:", err)
+			continue
+		}
+		return g.useLease(ctx, k, res, func(req *pb.ReleaseRequest) error {
+			return owner.Release(req, &pb.ReleaseResponse{})
+		})
+	}
+	return g.getLocally(ctx, k)
+}
+
+// useLease loads k if the lease is granted and releases it,
+// or returns the result of the holder
+func (g *Group) useLease(ctx context.Context, k string, res *pb.LeaseResponse,
+	release func(req *pb.ReleaseRequest) error) (ByteView, error) {
+	if !res.Granted {
+		g.Stats.LeaseWaits.Add(1)
+		if res.Error != "" {
+			return ByteView{}, errors.New(res.Error)
+		}
+		return g.populate(k, res.Value), nil
+	}
+
+	v, err := g.getLocally(ctx, k)
+	req := &pb.ReleaseRequest{Group: g.name, Key: k, LeaseId: res.LeaseId}
+	if err != nil {
+		req.Error = err.Error()
+	} else {
+		req.Value = v.ByteSlice()
+	}
+	if err := release(req); err != nil {
+		log.Println("[MyCache] Failed to release lease to peer:", err)
+	}
+	return v, err
+}
+
+// acquireLease serves a lease request of k as the owner. If k is cached
+// here, e.g. the owner is back, its value is returned instead.
+func (g *Group) acquireLease(ctx context.Context, k string) (*pb.LeaseResponse, error) {
+	if v, ok := g.mainCache.get(k); ok {
+		return &pb.LeaseResponse{Value: v.ByteSlice()}, nil
+	}
+	l, granted, err := g.leases.acquire(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	if granted {
+		return &pb.LeaseResponse{Granted: true, LeaseId: l.id}, nil
+	}
+	return &pb.LeaseResponse{Value: l.value, Error: l.err}, nil
+}
+
+// releaseLease serves a release of k as the owner, a good value
+// is cached here, where k belongs
+func (g *Group) releaseLease(in *pb.ReleaseRequest) {
+	if g.leases.release(in.Key, in.LeaseId, in.Value, in.Error) && in.Error == "" {
+		g.populate(in.Key, in.Value)
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github/mycache/pb"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downOwner fails fetches, but serves leases of its group
+type downOwner struct {
+	g *Group
+}
+
+func (p downOwner) Fetch(in *pb.Request, out *pb.Response) error {
+	return fmt.Errorf("owner is failing")
+}
+
+func (p downOwner) Invalidate(in *pb.InvalidateRequest, out *pb.InvalidateResponse) error {
+	return nil
+}
+
+func (p downOwner) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	res, err := p.g.acquireLease(context.Background(), in.Key)
+	if err == nil {
+		out.Granted, out.LeaseId, out.Value, out.Error = res.Granted, res.LeaseId, res.Value, res.Error
+	}
+	return err
+}
+
+func (p downOwner) Release(in *pb.ReleaseRequest, out *pb.ReleaseResponse) error {
+	p.g.releaseLease(in)
+	return nil
+}
+
+// deadPeer can't be reached
+type deadPeer struct{}
+
+func (deadPeer) Fetch(in *pb.Request, out *pb.Response) error { return fmt.Errorf("peer is down") }
+func (deadPeer) Invalidate(in *pb.InvalidateRequest, out *pb.InvalidateResponse) error {
+	return fmt.Errorf("peer is down")
+}
+func (deadPeer) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	return fmt.Errorf("peer is down")
+}
+func (deadPeer) Release(in *pb.ReleaseRequest, out *pb.ReleaseResponse) error {
+	return fmt.Errorf("peer is down")
+}
+
+// ownersPicker picks the same owners for all keys
+type ownersPicker []Peer
+
+func (p ownersPicker) Pick(key string) (Peer, bool)   { return p[0], true }
+func (p ownersPicker) PickN(key string, n int) []Peer { return p }
+func (p ownersPicker) Peers() []Peer                  { return p }
+
+func TestLease(t *testing.T) {
+	testLease(t, "lease", func(owner *Group) ownersPicker {
+		return ownersPicker{downOwner{owner}}
+	})
+}
+
+// the first owner is down, the second grants the lease
+func TestLeaseNextOwner(t *testing.T) {
+	testLease(t, "lease-next", func(owner *Group) ownersPicker {
+		return ownersPicker{deadPeer{}, downOwner{owner}}
+	})
+}
+
+func testLease(t *testing.T, name string, owners func(owner *Group) ownersPicker) {
+	owner := NewGroup(name+"-owner", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			return nil, fmt.Errorf("owner is failing")
+		}))
+	var loads int32
+	getter := GetterFunc(func(k string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(20 * time.Millisecond)
+		return []byte(k), nil
+	})
+
+	// three nodes fall back to load the owner's key at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		node := NewGroup(fmt.Sprintf("%s-node-%d", name, i), 2<<10, getter)
+		node.RegisterPeers(owners(owner))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := node.Get("Tom"); err != nil || v.String() != "Tom" {
+				t.Errorf("node should get the holder's result, got %v %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("only the lease holder should load, got %d loads", n)
+	}
+	if _, ok := owner.mainCache.get("Tom"); !ok {
+		t.Fatalf("owner should cache the released value")
+	}
+}
+
+func TestLeaseExpire(t *testing.T) {
+	leases := newLeaseTable(10 * time.Millisecond)
+	if _, granted, _ := leases.acquire(context.Background(), "k"); !granted {
+		t.Fatalf("first acquire should be granted")
+	}
+	// the holder never releases, the lease is granted again on expiry
+	if _, granted, _ := leases.acquire(context.Background(), "k"); !granted {
+		t.Fatalf("expired lease should be granted again")
+	}
+}
+
+func TestLeaseExpireDrop(t *testing.T) {
+	leases := newLeaseTable(10 * time.Millisecond)
+	leases.acquire(context.Background(), "k")
+	time.Sleep(30 * time.Millisecond)
+	leases.mu.Lock()
+	defer leases.mu.Unlock()
+	if len(leases.leases) != 0 {
+		t.Fatalf("expired lease should be dropped, got %d", len(leases.leases))
+	}
+}
+
+func TestLeaseSelfOwner(t *testing.T) {
+	var loads int32
+	g := NewGroup("lease-self", 2<<10, GetterFunc(func(k string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte(k), nil
+	}))
+	// the primary is down, self is the next owner and grants the lease
+	g.RegisterPeers(ownersPicker{deadPeer{}, nil})
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" || loads != 1 {
+		t.Fatalf("self should load with its own lease, got %v %v with %d loads", v, err, loads)
+	}
+	g.leases.mu.Lock()
+	defer g.leases.mu.Unlock()
+	if len(g.leases.leases) != 0 {
+		t.Fatalf("own lease should be released")
+	}
+}
+
+// replicaPeer is a failing replica which counts the leases asked of it
+type replicaPeer struct {
+	deadPeer
+	leases int32
+}
+
+func (p *replicaPeer) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	atomic.AddInt32(&p.leases, 1)
+	return p.deadPeer.Lease(in, out)
+}
+
+// zonePicker picks a replica to read from, not the ring owner
+type zonePicker struct {
+	replica Peer
+	owners  []Peer
+}
+
+func (p zonePicker) Pick(key string) (Peer, bool)   { return p.replica, true }
+func (p zonePicker) PickN(key string, n int) []Peer { return p.owners }
+func (p zonePicker) Peers() []Peer                  { return p.owners }
+
+func TestLeaseRingOwner(t *testing.T) {
+	owner := NewGroup("lease-ring-owner", 2<<10, GetterFunc(func(k string) ([]byte, error) {
+		return nil, fmt.Errorf("owner is failing")
+	}))
+	replica := &replicaPeer{}
+	g := NewGroup("lease-ring-node", 2<<10, GetterFunc(func(k string) ([]byte, error) {
+		return []byte(k), nil
+	}))
+	g.RegisterPeers(zonePicker{replica: replica, owners: []Peer{downOwner{owner}, replica}})
+
+	// the read from the replica fails, the lease is still the owner's
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+	if n := atomic.LoadInt32(&replica.leases); n != 0 {
+		t.Fatalf("lease should not be asked of the replica, got %d", n)
+	}
+	if _, ok := owner.mainCache.get("Tom"); !ok {
+		t.Fatalf("lease should be released to the ring owner")
+	}
+}
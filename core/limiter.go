@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// OverloadError is returned when a load is shed, because too
+// many getter loads are in flight and the wait queue is full
+// or the wait timed out
+type OverloadError struct {
+	Group string
+	Peer  string // the overloaded peer, empty if overloaded locally
+}
+
+func (e *OverloadError) Error() string {
+	if e.Peer != "" {
+		return fmt.Sprintf("group %s is overloaded on peer %s", e.Group, e.Peer)
+	}
+	return fmt.Sprintf("group %s is overloaded", e.Group)
+}
+
+// LimitOptions bounds the getter loads of a group
+type LimitOptions struct {
+	MaxInFlight  int           // getter loads running at the same time
+	MaxQueue     int           // loads waiting for a slot, the rest are shed
+	QueueTimeout time.Duration // max wait in queue, no limit if zero
+}
+
+// limiter is a semaphore with a bounded wait queue
+type limiter struct {
+	opts    LimitOptions
+	sem     chan struct{}
+	waiting int32 // loads in queue
+}
+
+func newLimiter(opts LimitOptions) *limiter {
+	return &limiter{
+		opts: opts,
+		sem:  make(chan struct{}, opts.MaxInFlight),
+	}
+}
+
+// acquire takes a slot, waiting in queue if there's no free one.
+// It returns false if the load should be shed, or ctx's error.
+// A nil error with true must be followed by a release.
+func (l *limiter) acquire(ctx context.Context) (bool, error) {
+	select {
+	case l.sem <- struct{}{}:
+		return true, nil
+	default:
+	}
+
+	if atomic.AddInt32(&l.waiting, 1) > int32(l.opts.MaxQueue) {
+		atomic.AddInt32(&l.waiting, -1)
+		return false, nil
+	}
+	defer atomic.AddInt32(&l.waiting, -1)
+
+	var timeout <-chan time.Time
+	if l.opts.QueueTimeout > 0 {
+		t := time.NewTimer(l.opts.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true, nil
+	case <-timeout:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (l *limiter) release() {
+	<-l.sem
+}
@@ -0,0 +1,50 @@
+package core
+
+import "time"
+
+// EvictReason tells why an entry is dropped from cache
+type EvictReason int
+
+const (
+	EvictCapacity    EvictReason = iota // dropped by LRU to fit maxBytes
+	EvictExpired                        // its TTL is passed
+	EvictInvalidated                    // dropped on purpose, e.g. by tag
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictInvalidated:
+		return "invalidated"
+	}
+	return "unknown"
+}
+
+// GroupObserver is notified of cache events of a group, to hook
+// metrics, tracing or audit in. Its methods are called synchronously,
+// so they should be fast and must not call back into the group.
+type GroupObserver interface {
+	OnHit(key string)
+	OnMiss(key string)
+	// OnLoad is called once per load, shared by concurrent callers
+	OnLoad(key string, d time.Duration, err error)
+	OnPeerFetch(peer Peer, key string, d time.Duration, err error)
+	OnEvict(key string, reason EvictReason)
+	// OnSet is called when a value is stored in cache
+	OnSet(key string, v ByteView)
+}
+
+// NopObserver ignores all events, embed it to observe only some of them
+type NopObserver struct{}
+
+func (NopObserver) OnHit(string)                                   {}
+func (NopObserver) OnMiss(string)                                  {}
+func (NopObserver) OnLoad(string, time.Duration, error)            {}
+func (NopObserver) OnPeerFetch(Peer, string, time.Duration, error) {}
+func (NopObserver) OnEvict(string, EvictReason)                    {}
+func (NopObserver) OnSet(string, ByteView)                         {}
+
+var _ GroupObserver = NopObserver{}
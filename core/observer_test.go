@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	NopObserver
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(format string, v ...interface{}) {
+	r.mu.Lock()
+	r.events = append(r.events, fmt.Sprintf(format, v...))
+	r.mu.Unlock()
+}
+
+func (r *recorder) OnHit(k string)                              { r.record("hit %s", k) }
+func (r *recorder) OnMiss(k string)                             { r.record("miss %s", k) }
+func (r *recorder) OnLoad(k string, d time.Duration, err error) { r.record("load %s %v", k, err) }
+func (r *recorder) OnEvict(k string, reason EvictReason)        { r.record("evict %s %v", k, reason) }
+func (r *recorder) OnSet(k string, v ByteView)                  { r.record("set %s %s", k, v) }
+
+func TestObserver(t *testing.T) {
+	g := NewGroup("observed", 10, GetterFunc(
+		func(k string) ([]byte, error) {
+			return []byte("12345"), nil
+		}))
+	r := &recorder{}
+	g.RegisterObserver(r)
+
+	g.Get("k1")
+	g.Get("k1")
+	g.Get("k2") // k1 is evicted to fit 10 bytes
+
+	expect := []string{
+		"miss k1", "set k1 12345", "load k1 <nil>",
+		"hit k1",
+		"miss k2", "evict k1 capacity", "set k2 12345", "load k2 <nil>",
+	}
+	if !reflect.DeepEqual(r.events, expect) {
+		t.Fatalf("expect events %v, got %v", expect, r.events)
+	}
+}
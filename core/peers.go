@@ -1,15 +1,54 @@
 package core
 
-import "github/mycache/pb"
+import (
+	"context"
+	"github/mycache/pb"
+)
 
 // PeerPicker peeks a peer by key, usually implemented as
 // a peers pool
 type PeerPicker interface {
 	Pick(key string) (peer Peer, ok bool)
+	// PickN returns the first n owners of key in order, the primary
+	// first. Self is nil, so callers know where it stands among them.
+	PickN(key string, n int) []Peer
+	// Peers returns all the peers but self, to broadcast to
+	Peers() []Peer
+}
+
+type withoutPeersKey struct{}
+
+// withoutPeers marks ctx of a load forwarded by a peer,
+// which is loaded locally instead of picking a peer again
+func withoutPeers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutPeersKey{}, true)
+}
+
+// forwarded tells whether ctx is marked by withoutPeers, and returns
+// ctx unmarked, for the loads of other keys the getter makes
+func forwarded(ctx context.Context) (context.Context, bool) {
+	if v, _ := ctx.Value(withoutPeersKey{}).(bool); !v {
+		return ctx, false
+	}
+	return context.WithValue(ctx, withoutPeersKey{}, false), true
+}
+
+// localLoadCounter is a PeerPicker counting the loads in flight it
+// leaves to the local node, when Pick returns false
+type localLoadCounter interface {
+	// localDone is called when such a load ends
+	localDone()
 }
 
 // Peer is a cache node that has many groups
 type Peer interface {
 	// Fetch looks up key in group
 	Fetch(in *pb.Request, out *pb.Response) error
+	// Invalidate drops entries of group on the peer only
+	Invalidate(in *pb.InvalidateRequest, out *pb.InvalidateResponse) error
+	// Lease asks the owner of key for the lease to load it,
+	// or waits for the result of the lease holder
+	Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error
+	// Release hands the result of a lease holder's load to the owner
+	Release(in *pb.ReleaseRequest, out *pb.ReleaseResponse) error
 }
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultRefreshConcurrency = 4
+
+// RefreshOptions controls refresh-ahead of hot keys
+type RefreshOptions struct {
+	// Ahead is the window before expiring, in which a hit
+	// triggers a background reload
+	Ahead time.Duration
+	// MinHits is how many hits since the last load a key needs
+	// to be refreshed, colder keys are left to expire
+	MinHits int
+	// MaxConcurrent bounds the background reloads in flight,
+	// defaultRefreshConcurrency if <= 0
+	MaxConcurrent int
+}
+
+// refresher decides which keys to reload before they expire,
+// based on the hits since their last load
+type refresher struct {
+	opts RefreshOptions
+	sem  chan struct{} // bounds the reloads in flight
+
+	mu      sync.Mutex
+	hits    map[string]int      // hits since last load
+	loading map[string]struct{} // keys being refreshed
+}
+
+func newRefresher(opts RefreshOptions) *refresher {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = defaultRefreshConcurrency
+	}
+	return &refresher{
+		opts:    opts,
+		sem:     make(chan struct{}, opts.MaxConcurrent),
+		hits:    make(map[string]int),
+		loading: make(map[string]struct{}),
+	}
+}
+
+// hit records a hit of k, and reports whether k should be
+// refreshed now. If true, the caller must call done(k) after reloading.
+func (r *refresher) hit(k string, v ByteView, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hits[k]++
+	if v.e.IsZero() || v.e.Sub(now) > r.opts.Ahead {
+		return false
+	}
+	if r.hits[k] < r.opts.MinHits {
+		return false // gone cold, let it expire
+	}
+	if _, ok := r.loading[k]; ok {
+		return false
+	}
+	select {
+	case r.sem <- struct{}{}:
+	default:
+		return false // too many reloads, try on next hit
+	}
+	r.loading[k] = struct{}{}
+	return true
+}
+
+func (r *refresher) done(k string) {
+	r.mu.Lock()
+	delete(r.loading, k)
+	r.mu.Unlock()
+	<-r.sem
+}
+
+// forget resets the hits of k, called when k is loaded or evicted
+func (r *refresher) forget(k string) {
+	r.mu.Lock()
+	delete(r.hits, k)
+	r.mu.Unlock()
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how a failed getter load is retried,
+// the zero value means no retry
+type RetryPolicy struct {
+	Attempts  int           // max getter calls of a load, including the first
+	BaseDelay time.Duration // delay before the first retry
+	MaxDelay  time.Duration // cap of the delay, no cap if zero
+}
+
+// backoff returns the delay before retry n (0 based), and false
+// if there is no retry left. The delay grows exponentially with
+// full jitter, in [0, min(MaxDelay, BaseDelay*2^n)).
+func (p RetryPolicy) backoff(n int) (time.Duration, bool) {
+	if n+1 >= p.Attempts {
+		return 0, false
+	}
+	d := p.BaseDelay << uint(n)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(d))), true
+}
+
+// permanent wraps an error fn of do knows retrying can't fix
+type permanent struct {
+	err error
+}
+
+func (e permanent) Error() string { return e.err.Error() }
+
+// do calls fn until it succeeds, fails with a permanent error,
+// the attempts run out or the deadline of ctx comes, returns the
+// last error
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for n := 0; ; n++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if pe, ok := err.(permanent); ok {
+			return pe.err
+		}
+		delay, ok := p.backoff(n)
+		if !ok {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
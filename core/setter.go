@@ -0,0 +1,296 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/mycache/pb"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultBatchSize     = 100
+)
+
+// Setter sets the value identified by key, to datasource
+type Setter interface {
+	Set(k string, v []byte) error
+}
+
+// SetterFunc implements Setter with a function
+type SetterFunc func(k string, v []byte) error
+
+func (f SetterFunc) Set(k string, v []byte) error {
+	return f(k, v)
+}
+
+// BatchSetter is implemented by a Setter that can write many values
+// in one call, which write-behind prefers to flush with
+type BatchSetter interface {
+	SetBatch(kvs map[string][]byte) error
+}
+
+// WriteMode tells when a value set to the group is written to datasource
+type WriteMode int
+
+const (
+	WriteThrough WriteMode = iota // before Set returns
+	WriteBehind                   // later, in batches
+)
+
+// WriteOptions controls how values are written to datasource
+type WriteOptions struct {
+	Mode  WriteMode
+	Retry RetryPolicy // retries failed writes
+
+	// write-behind only
+	FlushInterval time.Duration // defaultFlushInterval if zero
+	BatchSize     int           // pending values that trigger a flush, defaultBatchSize if zero
+}
+
+// RegisterSetter makes the group writable with Set.
+// It should be called once, before serving.
+func (g *Group) RegisterSetter(s Setter, opts WriteOptions) {
+	if g.setter != nil {
+		panic("[RegisterSetter] called more than once")
+	}
+	g.setter = s
+	g.writeOpts = opts
+	if opts.Mode == WriteBehind {
+		g.writer = newWriteBehind(g, opts)
+		go g.writer.run()
+	}
+}
+
+// Set sets the value of k, and writes it to datasource
+func (g *Group) Set(k string, v []byte) error {
+	return g.SetContext(context.Background(), k, v)
+}
+
+// SetContext is like Set. In write-through mode, the value is cached
+// once the setter acknowledges it, and retries stop when ctx is done.
+// The write is done then, failing to invalidate the peers is logged.
+// In write-behind mode, the value is cached as dirty at once, and
+// written later in batches. This node reads the dirty value back
+// instead of asking the owner of k, whose copy is dropped.
+func (g *Group) SetContext(ctx context.Context, k string, v []byte) error {
+	if k == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.setter == nil {
+		return errors.New("group is read only, no setter registered")
+	}
+	v = clone(v)
+
+	if g.writer != nil {
+		g.writer.enqueue(k, v)
+		g.populate(k, v)
+		g.invalidateOwner(k)
+		return nil
+	}
+
+	err := g.writeOpts.Retry.do(ctx, func() error {
+		err := g.setter.Set(k, v)
+		if err != nil {
+			g.Stats.WriteErrs.Add(1)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	g.Stats.Writes.Add(1)
+	g.populate(k, v)
+	if err := g.broadcast(&pb.InvalidateRequest{Group: g.name, Keys: []string{k}}); err != nil {
+		log.Println("[MyCache] Failed to invalidate peers after write:", err)
+	}
+	return nil
+}
+
+// Flush writes the dirty values to datasource now, in write-behind mode
+func (g *Group) Flush() error {
+	if g.writer == nil {
+		return nil
+	}
+	return g.writer.flush()
+}
+
+// Close stops writing behind in background, then flushes the dirty
+// values. If it fails they are kept, and may be written with Flush.
+func (g *Group) Close() error {
+	if g.writer == nil {
+		return nil
+	}
+	g.writer.stop()
+	return g.writer.flush()
+}
+
+// invalidateOwner drops the owner's copy of k, which is stale
+// until the dirty value is flushed
+func (g *Group) invalidateOwner(k string) {
+	if g.peers == nil {
+		return
+	}
+	peer, ok := g.peers.Pick(g.pickKey(k))
+	if !ok {
+		return
+	}
+	in := &pb.InvalidateRequest{Group: g.name, Keys: []string{k}}
+	if err := peer.Invalidate(in, &pb.InvalidateResponse{}); err != nil {
+		log.Println("[MyCache] Failed to invalidate the owner:", err)
+	}
+}
+
+// dirty returns the value of k which is set but not written yet
+func (g *Group) dirty(k string) ([]byte, bool) {
+	if g.writer == nil {
+		return nil, false
+	}
+	return g.writer.get(k)
+}
+
+// writeBehind queues values set to a group, and writes them to
+// datasource in batches. Values of the same key are coalesced,
+// only the latest one is written.
+type writeBehind struct {
+	g       *Group
+	opts    WriteOptions
+	kick    chan struct{} // triggers a flush before interval
+	flushMu sync.Mutex    // one flush at a time
+
+	stopOnce sync.Once
+	stopping chan struct{} // closed to stop run
+	stopped  chan struct{} // closed when run returns
+
+	mu       sync.Mutex
+	pending  map[string][]byte // set but not flushed yet
+	flushing map[string][]byte // being flushed
+}
+
+func newWriteBehind(g *Group, opts WriteOptions) *writeBehind {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	return &writeBehind{
+		g:        g,
+		opts:     opts,
+		kick:     make(chan struct{}, 1),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+		pending:  make(map[string][]byte),
+	}
+}
+
+func (w *writeBehind) enqueue(k string, v []byte) {
+	w.mu.Lock()
+	w.pending[k] = v
+	full := len(w.pending) >= w.opts.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// get returns the dirty value of k, the latest set wins
+func (w *writeBehind) get(k string) ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if v, ok := w.pending[k]; ok {
+		return v, true
+	}
+	v, ok := w.flushing[k]
+	return v, ok
+}
+
+func (w *writeBehind) run() {
+	defer close(w.stopped)
+	t := time.NewTicker(w.opts.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-w.kick:
+		case <-w.stopping:
+			return
+		}
+		if err := w.flush(); err != nil {
+			log.Println("[MyCache] Failed to write behind:", err)
+		}
+	}
+}
+
+// stop stops run and waits for it to return
+func (w *writeBehind) stop() {
+	w.stopOnce.Do(func() { close(w.stopping) })
+	<-w.stopped
+}
+
+// flush writes the pending values, values failed after retries
+// are queued again unless they are set since
+func (w *writeBehind) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = make(map[string][]byte)
+	w.flushing = batch
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.opts.Retry.do(context.Background(), func() error {
+		err := w.write(batch)
+		if err != nil {
+			w.g.Stats.WriteErrs.Add(1)
+		}
+		return err
+	})
+
+	w.mu.Lock()
+	w.flushing = nil
+	if err != nil {
+		for k, v := range batch {
+			if _, ok := w.pending[k]; !ok {
+				w.pending[k] = v
+			}
+		}
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w.g.Stats.Writes.Add(int64(len(batch)))
+	keys := make([]string, 0, len(batch))
+	for k := range batch {
+		keys = append(keys, k)
+	}
+	if err := w.g.broadcast(&pb.InvalidateRequest{Group: w.g.name, Keys: keys}); err != nil {
+		log.Println("[MyCache] Failed to invalidate peers after write:", err)
+	}
+	return nil
+}
+
+func (w *writeBehind) write(batch map[string][]byte) error {
+	if bs, ok := w.g.setter.(BatchSetter); ok {
+		return bs.SetBatch(batch)
+	}
+	for k, v := range batch {
+		if err := w.g.setter.Set(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
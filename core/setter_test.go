@@ -0,0 +1,164 @@
+package core
+
+import (
+	"fmt"
+	"github/mycache/pb"
+	"sync"
+	"testing"
+	"time"
+)
+
+// store is a datasource that can be read and written
+type store struct {
+	mu      sync.Mutex
+	data    map[string]string
+	fail    int // fail the next writes
+	batches int
+}
+
+func (s *store) Get(k string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.data[k]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%s not exist", k)
+}
+
+func (s *store) Set(k string, v []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return fmt.Errorf("db is flapping")
+	}
+	s.data[k] = string(v)
+	return nil
+}
+
+type batchStore struct{ *store }
+
+func (s batchStore) SetBatch(kvs map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	for k, v := range kvs {
+		s.data[k] = string(v)
+	}
+	return nil
+}
+
+func TestWriteThrough(t *testing.T) {
+	s := &store{data: map[string]string{}, fail: 1}
+	g := NewGroup("write-through", 2<<10, s)
+	g.RegisterSetter(s, WriteOptions{Retry: RetryPolicy{Attempts: 2}})
+	// a peer missing the invalidation doesn't fail the write
+	g.RegisterPeers(ownersPicker{deadPeer{}})
+
+	if err := g.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if s.data["Tom"] != "630" {
+		t.Fatalf("value should be written to datasource")
+	}
+	if v, ok := g.mainCache.get("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("acknowledged value should be cached")
+	}
+
+	s.fail = 2
+	if err := g.Set("Sam", []byte("567")); err == nil {
+		t.Fatalf("should fail after retries")
+	}
+	if _, ok := g.mainCache.get("Sam"); ok {
+		t.Fatalf("failed value should not be cached")
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	s := &store{data: map[string]string{"Tom": "600"}}
+	g := NewGroup("write-behind", 2<<10, s)
+	g.RegisterSetter(batchStore{s}, WriteOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+
+	g.Set("Tom", []byte("610"))
+	g.Set("Tom", []byte("630"))
+	g.Set("Sam", []byte("567"))
+
+	// dirty value wins over the stale datasource, even if evicted
+	g.mainCache.removeKey("Tom")
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("should read the dirty value, got %v %v", v, err)
+	}
+	if s.data["Tom"] != "600" {
+		t.Fatalf("value should not be written before flush")
+	}
+
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.data["Tom"] != "630" || s.data["Sam"] != "567" || s.batches != 1 {
+		t.Fatalf("values should be coalesced and written in a batch, got %v", s.data)
+	}
+	if _, ok := g.dirty("Tom"); ok {
+		t.Fatalf("value should be clean after flush")
+	}
+}
+
+func TestWriteBehindClose(t *testing.T) {
+	s := &store{data: map[string]string{}}
+	g := NewGroup("write-behind-close", 2<<10, s)
+	g.RegisterSetter(s, WriteOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+
+	g.Set("Tom", []byte("630"))
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s.data["Tom"] != "630" {
+		t.Fatalf("dirty value should be flushed on close")
+	}
+	select {
+	case <-g.writer.stopped:
+	default:
+		t.Fatalf("writer should be stopped")
+	}
+	if err := g.Close(); err != nil {
+		t.Fatalf("second close should be a no-op, got %v", err)
+	}
+}
+
+// ownerPeer serves fetches and invalidations of its group
+type ownerPeer struct {
+	downOwner
+}
+
+func (p ownerPeer) Fetch(in *pb.Request, out *pb.Response) error {
+	v, err := p.g.Get(in.Key)
+	out.Value = v.ByteSlice()
+	return err
+}
+
+func (p ownerPeer) Invalidate(in *pb.InvalidateRequest, out *pb.InvalidateResponse) error {
+	out.Removed = int64(p.g.invalidateLocally(in))
+	return nil
+}
+
+func TestWriteBehindPeer(t *testing.T) {
+	s := &store{data: map[string]string{"Tom": "600"}}
+	owner := NewGroup("write-behind-owner", 2<<10, s)
+	g := NewGroup("write-behind-node", 2<<10, s)
+	g.RegisterPeers(ownersPicker{ownerPeer{downOwner{owner}}})
+	g.RegisterSetter(s, WriteOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "600" {
+		t.Fatalf("should get from the owner, got %v %v", v, err)
+	}
+	g.Set("Tom", []byte("630"))
+	if _, ok := owner.mainCache.get("Tom"); ok {
+		t.Fatalf("owner's stale copy should be dropped")
+	}
+
+	// the node reads its own write back, not the owner's stale value
+	g.mainCache.removeKey("Tom")
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("should read the dirty value, got %v %v", v, err)
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// Stats are per-group statistics
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // either cache was good
+	PeerLoads      AtomicInt // either remote load or remote cache hit
+	PeerErrors     AtomicInt
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads, retries included
+	Retries        AtomicInt // getter calls retried after failure
+	BreakerRejects AtomicInt // loads failed fast by the open breaker
+	BreakerState   AtomicInt // current BreakerState
+	LoadsShed      AtomicInt // loads rejected by the load limit
+	LoadPanics     AtomicInt // loads panicked in getter or peer
+	LeaseWaits     AtomicInt // loads served by another node's lease
+	Writes         AtomicInt // values acknowledged by the setter
+	WriteErrs      AtomicInt // failed setter calls, retries included
+}
+
+// AtomicInt is an int64 to be accessed atomically
+type AtomicInt int64
+
+// Add atomically adds n to i
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Set atomically sets i to n
+func (i *AtomicInt) Set(n int64) {
+	atomic.StoreInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
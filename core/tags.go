@@ -0,0 +1,57 @@
+package core
+
+// Tagger tags the value of k when it's loaded, so entries can
+// be dropped by tag later
+type Tagger interface {
+	Tags(k string, v []byte) []string
+}
+
+// TaggerFunc implements Tagger with a function
+type TaggerFunc func(k string, v []byte) []string
+
+func (f TaggerFunc) Tags(k string, v []byte) []string {
+	return f(k, v)
+}
+
+// tagIndex maps tags to keys and back, not safe for concurrency
+type tagIndex struct {
+	keys map[string]map[string]struct{} // tag to keys
+	tags map[string][]string            // key to tags
+}
+
+func (t *tagIndex) add(k string, tags []string) {
+	t.remove(k)
+	if len(tags) == 0 {
+		return
+	}
+	if t.keys == nil {
+		t.keys = make(map[string]map[string]struct{})
+		t.tags = make(map[string][]string)
+	}
+	t.tags[k] = tags
+	for _, tag := range tags {
+		if t.keys[tag] == nil {
+			t.keys[tag] = make(map[string]struct{})
+		}
+		t.keys[tag][k] = struct{}{}
+	}
+}
+
+func (t *tagIndex) remove(k string) {
+	for _, tag := range t.tags[k] {
+		delete(t.keys[tag], k)
+		if len(t.keys[tag]) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+	delete(t.tags, k)
+}
+
+// lookup returns the keys tagged with tag
+func (t *tagIndex) lookup(tag string) []string {
+	keys := make([]string, 0, len(t.keys[tag]))
+	for k := range t.keys[tag] {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Warm loads keys through the normal path with at most concurrency
+// loads in flight, so keys owned by peers are loaded by their owners.
+// It goes on after a failed key, the returned error tells how many
+// keys failed and the first error, or it's ctx's error if ctx ends.
+func (g *Group) Warm(ctx context.Context, keys []string, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+		first  error
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, k := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(k string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, err := g.GetContext(ctx, k); err != nil {
+				mu.Lock()
+				if failed++; first == nil {
+					first = err
+				}
+				mu.Unlock()
+			}
+		}(k)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("warm up %d of %d keys failed, first: %v", failed, len(keys), first)
+	}
+	return nil
+}
+
+// HotKeys returns at most n of the most recently used keys
+// in cache, which can be saved to warm up the next run
+func (g *Group) HotKeys(n int) []string {
+	return g.mainCache.keys(n)
+}
+
+// ReadKeys reads keys from r, one per line, blank lines are skipped
+func ReadKeys(r io.Reader) ([]string, error) {
+	var keys []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if k := strings.TrimSpace(sc.Text()); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys, sc.Err()
+}
+
+// ReadKeysFile reads keys from the file at path, see ReadKeys
+func ReadKeysFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadKeys(f)
+}
+
+// WriteKeysFile writes keys to the file at path, one per line.
+// The file is replaced atomically, so a crash never leaves half of it.
+func WriteKeysFile(path string, keys []string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	for _, k := range keys {
+		w.WriteString(k)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
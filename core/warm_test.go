@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWarm(t *testing.T) {
+	var loads int32
+	g := NewGroup("warm", 2<<10, GetterFunc(
+		func(k string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			if v, ok := db[k]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", k)
+		}))
+
+	if err := g.Warm(context.Background(), []string{"Amy", "Beney", "unknown"}, 2); err == nil {
+		t.Fatalf("should report the unknown key")
+	}
+	g.Get("Amy")
+	g.Get("Beney")
+	if n := atomic.LoadInt32(&loads); n != 3 {
+		t.Fatalf("warmed keys should hit cache, got %d loads", n)
+	}
+}
+
+func TestKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hotkeys")
+	keys := []string{"Amy", "Beney", "Roger"}
+	if err := WriteKeysFile(path, keys); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadKeysFile(path)
+	if err != nil || !reflect.DeepEqual(got, keys) {
+		t.Fatalf("should read back %v, got %v %v", keys, got, err)
+	}
+}
@@ -1,6 +1,6 @@
 module github/mycache
 
-go 1.15
+go 1.18
 
 require (
 	github.com/golang/protobuf v1.5.2
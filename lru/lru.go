@@ -2,6 +2,14 @@ package lru
 
 import "container/list"
 
+// Policy decides which element is evicted first
+type Policy int
+
+const (
+	LRU  Policy = iota // the least recently used
+	FIFO               // the oldest added, regardless of use
+)
+
 // Cache is a LRU locate. Not safe for concurrency.
 type Cache struct {
 	maxBytes int64      // max usable bytes
@@ -9,6 +17,7 @@ type Cache struct {
 	lst      *list.List // head is the most active element
 	locate   map[string]*list.Element
 	onEvict  func(k string, v Value)
+	policy   Policy
 }
 
 // Value should has Len()
@@ -35,31 +44,48 @@ func New(maxBytes int64, onEvict func(string, Value)) *Cache {
 
 func (c *Cache) Get(k string) (v Value, ok bool) {
 	if elm, ok := c.locate[k]; ok {
-		c.lst.MoveToFront(elm)
+		if c.policy == LRU {
+			c.lst.MoveToFront(elm)
+		}
 		kv := elm.Value.(*entry)
 		return kv.v, true
 	}
 	return
 }
 
+// Remove removes the least recently used element
 func (c *Cache) Remove() {
 	if elm := c.lst.Back(); elm != nil {
-		c.lst.Remove(elm)
-		kv := elm.Value.(*entry)
-		delete(c.locate, kv.k)
-		c.bytesCnt -= int64(len(kv.k)) + int64(kv.v.Len())
-		if c.onEvict != nil {
-			c.onEvict(kv.k, kv.v)
-		}
+		c.removeElement(elm)
 	}
+}
 
+// Delete removes k from the cache, returns false if k is absent
+func (c *Cache) Delete(k string) bool {
+	elm, ok := c.locate[k]
+	if ok {
+		c.removeElement(elm)
+	}
+	return ok
+}
+
+func (c *Cache) removeElement(elm *list.Element) {
+	c.lst.Remove(elm)
+	kv := elm.Value.(*entry)
+	delete(c.locate, kv.k)
+	c.bytesCnt -= int64(len(kv.k)) + int64(kv.v.Len())
+	if c.onEvict != nil {
+		c.onEvict(kv.k, kv.v)
+	}
 }
 
 // Add adds new value to the cache,
 // replace the old value if key exists
 func (c *Cache) Add(k string, v Value) {
 	if elm, ok := c.locate[k]; ok {
-		c.lst.MoveToFront(elm)
+		if c.policy == LRU {
+			c.lst.MoveToFront(elm)
+		}
 		kv := elm.Value.(*entry)
 		c.bytesCnt += int64(v.Len()) - int64(kv.v.Len())
 		kv.v = v
@@ -68,12 +94,41 @@ func (c *Cache) Add(k string, v Value) {
 		c.locate[k] = elm
 		c.bytesCnt += int64(len(k)) + int64(v.Len())
 	}
-	// should not oversize
+	c.shrink()
+}
+
+// SetMaxBytes changes the max usable bytes, elements are
+// evicted at once to fit
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.shrink()
+}
+
+// SetPolicy changes which element is evicted first
+func (c *Cache) SetPolicy(p Policy) {
+	c.policy = p
+}
+
+// shrink evicts until the cache should not oversize
+func (c *Cache) shrink() {
 	for c.maxBytes != 0 && c.bytesCnt > c.maxBytes {
 		c.Remove()
 	}
 }
 
+// Keys returns at most n keys from the most recently used,
+// all keys if n <= 0
+func (c *Cache) Keys(n int) []string {
+	if n <= 0 || n > c.lst.Len() {
+		n = c.lst.Len()
+	}
+	keys := make([]string, 0, n)
+	for elm := c.lst.Front(); elm != nil && len(keys) < n; elm = elm.Next() {
+		keys = append(keys, elm.Value.(*entry).k)
+	}
+	return keys
+}
+
 func (c *Cache) Len() int {
 	return c.lst.Len()
 }
@@ -19,3 +19,65 @@ func TestGet(t *testing.T) {
 		t.Fatalf("cache hit testKey1=1235 succeeded, but should not")
 	}
 }
+
+func TestDelete(t *testing.T) {
+	var evicted []string
+	cache := New(int64(0), func(k string, v Value) {
+		evicted = append(evicted, k)
+	})
+	cache.Add("k1", String("v1"))
+	cache.Add("k2", String("v2"))
+
+	if !cache.Delete("k1") {
+		t.Fatalf("delete k1 failed")
+	}
+	if cache.Delete("k1") {
+		t.Fatalf("k1 deleted twice")
+	}
+	if _, ok := cache.Get("k1"); ok || cache.Len() != 1 {
+		t.Fatalf("k1 still in cache after delete")
+	}
+	if len(evicted) != 1 || evicted[0] != "k1" {
+		t.Fatalf("onEvict should be called with k1, got %v", evicted)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	cache := New(int64(0), nil)
+	cache.Add("k1", String("v1"))
+	cache.Add("k2", String("v2"))
+	cache.Add("k3", String("v3"))
+	cache.Get("k1")
+
+	if keys := cache.Keys(2); len(keys) != 2 || keys[0] != "k1" || keys[1] != "k3" {
+		t.Fatalf("should return most recently used keys first, got %v", keys)
+	}
+	if keys := cache.Keys(0); len(keys) != 3 {
+		t.Fatalf("should return all keys, got %v", keys)
+	}
+}
+
+func TestSetMaxBytes(t *testing.T) {
+	cache := New(int64(0), nil)
+	cache.Add("k1", String("v1"))
+	cache.Add("k2", String("v2"))
+	cache.Add("k3", String("v3"))
+
+	cache.SetMaxBytes(8)
+	if keys := cache.Keys(0); len(keys) != 2 || keys[0] != "k3" || keys[1] != "k2" {
+		t.Fatalf("should evict the oldest to fit, got %v", keys)
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	cache := New(int64(8), nil)
+	cache.SetPolicy(FIFO)
+	cache.Add("k1", String("v1"))
+	cache.Add("k2", String("v2"))
+	cache.Get("k1")
+	cache.Add("k3", String("v3"))
+
+	if _, ok := cache.Get("k1"); ok {
+		t.Fatalf("k1 is the oldest and should be evicted, even if used")
+	}
+}
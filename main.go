@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github/mycache/core"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"time"
 )
 
 var scoreDB = map[string]string{
@@ -25,13 +30,74 @@ func createGroup() *core.Group {
 		}))
 }
 
-// start cache server
-func startCache(addr string, addrs []string, myc *core.Group) {
+// start cache server, and warm up with keys in warmFiles once the
+// peers are serving, so that their keys are loaded by them
+func startCache(addr string, addrs []string, seed string, myc *core.Group, warmFiles ...string) {
 	peers := core.NewHTTPPool(addr)
+	if seed != "" {
+		peers.SetSeed([]byte(seed))
+	}
 	peers.Set(addrs...)
 	myc.RegisterPeers(peers)
+
+	ln, err := net.Listen("tcp", addr[len("http://"):])
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), warmWait)
+		defer cancel()
+		if err := peers.WaitPeers(ctx); err != nil {
+			log.Println("[Warm up] skipped, peers are not serving:", err)
+			return
+		}
+		warmUp(myc, warmFiles...)
+	}()
 	log.Println("mycache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[len("http://"):], peers))
+	log.Fatal(http.Serve(ln, peers))
+}
+
+// start admin server, groups can be tuned live through it. It has no
+// auth, so adminAddr must be reachable by operators only.
+func startAdmin(adminAddr string) {
+	admin := core.NewAdmin()
+	mux := http.NewServeMux()
+	mux.Handle(admin.BasePath(), admin)
+	log.Println("admin server running at", adminAddr)
+	log.Fatal(http.ListenAndServe(adminAddr, mux))
+}
+
+// warmUp preloads the keys listed in the files, missing files are skipped
+func warmUp(myc *core.Group, paths ...string) {
+	var keys []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		ks, err := core.ReadKeysFile(path)
+		if err != nil {
+			log.Println("[Warm up] skip key file:", err)
+			continue
+		}
+		keys = append(keys, ks...)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := myc.Warm(context.Background(), keys, warmConcurrency); err != nil {
+		log.Println("[Warm up]", err)
+	}
+	log.Printf("[Warm up] done with %d keys", len(keys))
+}
+
+// recordHotKeys saves the hot keys to path periodically,
+// for the next run to warm up with
+func recordHotKeys(myc *core.Group, path string) {
+	for range time.Tick(hotKeysInterval) {
+		if err := core.WriteKeysFile(path, myc.HotKeys(hotKeysLimit)); err != nil {
+			log.Println("[Hot keys] failed to save:", err)
+		}
+	}
 }
 
 // start api server for user
@@ -39,7 +105,16 @@ func startAPI(apiAddr string, myc *core.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := myc.Get(key)
+			view, err := myc.GetContext(r.Context(), key)
+			var oe *core.OverloadError
+			if errors.As(err, &oe) {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			if errors.Is(err, core.ErrCircuitOpen) {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -51,11 +126,29 @@ func startAPI(apiAddr string, myc *core.Group) {
 	log.Fatal(http.ListenAndServe(apiAddr[len("http://"):], nil))
 }
 
+const (
+	warmConcurrency = 8
+	warmWait        = time.Minute // for peers to serve before warming up
+	hotKeysLimit    = 1000
+	hotKeysInterval = time.Minute
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ring" {
+		if err := runRing(os.Args[2:]); err != nil {
+			log.Fatal("[Ring] ", err)
+		}
+		return
+	}
+
 	var port int
 	var api bool
+	var warm, hotKeys, admin string
 	flag.IntVar(&port, "port", 8081, "MyCache server port")
 	flag.BoolVar(&api, "api", false, "Start an api sever?")
+	flag.StringVar(&warm, "warm", "", "File of keys to preload at startup, one per line")
+	flag.StringVar(&hotKeys, "hotkeys", "", "File to record hot keys in, and preload from at startup")
+	flag.StringVar(&admin, "admin", "", "Address of the admin server, e.g. localhost:9081, off if empty. It has no auth, never expose it")
 	flag.Parse()
 
 	apiAddr := "http://localhost:6789"
@@ -74,5 +167,13 @@ func main() {
 	if api {
 		go startAPI(apiAddr, myc)
 	}
-	startCache(addrMap[port], addrs, myc)
+	if hotKeys != "" {
+		go recordHotKeys(myc, hotKeys)
+	}
+	if admin != "" {
+		go startAdmin(admin)
+	}
+	// the secret seed of the hash ring, shared by all nodes, is read
+	// from the environment, ps would show it as a flag
+	startCache(addrMap[port], addrs, os.Getenv("MYCACHE_SEED"), myc, warm, hotKeys)
 }
@@ -0,0 +1,166 @@
+package radix
+
+import (
+	"sort"
+	"strings"
+)
+
+// Tree is a radix tree of keys, which are visited in order.
+// Not safe for concurrency.
+type Tree struct {
+	root node
+	size int
+}
+
+type node struct {
+	prefix   string  // label of the edge from parent
+	leaf     bool    // a key ends here
+	children []*node // sorted by prefix[0]
+}
+
+// New constructor of Tree
+func New() *Tree {
+	return &Tree{}
+}
+
+// Insert adds k, returns false if k exists
+func (t *Tree) Insert(k string) bool {
+	n, search := &t.root, k
+	for {
+		if search == "" {
+			if n.leaf {
+				return false
+			}
+			n.leaf = true
+			t.size++
+			return true
+		}
+
+		idx, child := n.child(search[0])
+		if child == nil {
+			n.insertChild(idx, &node{prefix: search, leaf: true})
+			t.size++
+			return true
+		}
+		common := commonPrefix(search, child.prefix)
+		if common == len(child.prefix) {
+			n, search = child, search[common:]
+			continue
+		}
+
+		// split the edge at the common prefix
+		split := &node{prefix: search[:common], children: []*node{child}}
+		child.prefix = child.prefix[common:]
+		n.children[idx] = split
+		if search = search[common:]; search == "" {
+			split.leaf = true
+		} else {
+			idx, _ := split.child(search[0])
+			split.insertChild(idx, &node{prefix: search, leaf: true})
+		}
+		t.size++
+		return true
+	}
+}
+
+// Delete removes k, returns false if k is absent
+func (t *Tree) Delete(k string) bool {
+	if t.root.delete(k) {
+		t.size--
+		return true
+	}
+	return false
+}
+
+// Walk visits keys with prefix in order, until fn returns false
+func (t *Tree) Walk(prefix string, fn func(k string) bool) {
+	n, path, search := &t.root, "", prefix
+	for search != "" {
+		_, child := n.child(search[0])
+		switch {
+		case child == nil:
+			return
+		case strings.HasPrefix(search, child.prefix):
+			search = search[len(child.prefix):]
+		case strings.HasPrefix(child.prefix, search):
+			search = ""
+		default:
+			return
+		}
+		n, path = child, path+child.prefix
+	}
+	n.walk(path, fn)
+}
+
+// Len returns how many keys are in the tree
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// child returns the child whose label starts with c, and its index.
+// If there's no such child, the index is where it should be inserted.
+func (n *node) child(c byte) (int, *node) {
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= c
+	})
+	if idx < len(n.children) && n.children[idx].prefix[0] == c {
+		return idx, n.children[idx]
+	}
+	return idx, nil
+}
+
+func (n *node) insertChild(idx int, c *node) {
+	n.children = append(n.children, nil)
+	copy(n.children[idx+1:], n.children[idx:])
+	n.children[idx] = c
+}
+
+// delete removes search under n, and compacts the nodes on the way back
+func (n *node) delete(search string) bool {
+	if search == "" {
+		if !n.leaf {
+			return false
+		}
+		n.leaf = false
+		return true
+	}
+
+	idx, child := n.child(search[0])
+	if child == nil || !strings.HasPrefix(search, child.prefix) {
+		return false
+	}
+	if !child.delete(search[len(child.prefix):]) {
+		return false
+	}
+	if !child.leaf {
+		switch len(child.children) {
+		case 0:
+			n.children = append(n.children[:idx], n.children[idx+1:]...)
+		case 1:
+			grandchild := child.children[0]
+			grandchild.prefix = child.prefix + grandchild.prefix
+			n.children[idx] = grandchild
+		}
+	}
+	return true
+}
+
+func (n *node) walk(path string, fn func(k string) bool) bool {
+	if n.leaf && !fn(path) {
+		return false
+	}
+	for _, c := range n.children {
+		if !c.walk(path+c.prefix, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,49 @@
+package radix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func keys(t *Tree, prefix string) []string {
+	var ks []string
+	t.Walk(prefix, func(k string) bool {
+		ks = append(ks, k)
+		return true
+	})
+	return ks
+}
+
+func TestTree(t *testing.T) {
+	tree := New()
+	for _, k := range []string{"report/2026/10/b", "report/2026/10/a", "report/2026/9", "report", "user/1"} {
+		if !tree.Insert(k) {
+			t.Fatalf("insert %s failed", k)
+		}
+	}
+	if tree.Insert("report") || tree.Len() != 5 {
+		t.Fatalf("report inserted twice")
+	}
+
+	cases := map[string][]string{
+		"":               {"report", "report/2026/10/a", "report/2026/10/b", "report/2026/9", "user/1"},
+		"report/2026/1":  {"report/2026/10/a", "report/2026/10/b"},
+		"report/2026/10": {"report/2026/10/a", "report/2026/10/b"},
+		"rep":            {"report", "report/2026/10/a", "report/2026/10/b", "report/2026/9"},
+		"report/2027":    nil,
+	}
+	for prefix, expect := range cases {
+		if got := keys(tree, prefix); !reflect.DeepEqual(got, expect) {
+			t.Errorf("prefix %q: expect %v, got %v", prefix, expect, got)
+		}
+	}
+
+	if !tree.Delete("report") || tree.Delete("report") || tree.Delete("report/2026") {
+		t.Fatalf("delete should only remove existing keys")
+	}
+	tree.Delete("report/2026/10/a")
+	expect := []string{"report/2026/10/b", "report/2026/9"}
+	if got := keys(tree, "report"); !reflect.DeepEqual(got, expect) || tree.Len() != 3 {
+		t.Fatalf("expect %v after delete, got %v", expect, got)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github/mycache/consistent"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runRing is the ring subcommand, it reports how a ring spreads keys
+// over the given peers, to choose replicas and hash with data:
+//
+//	mycache ring -peers a=4,b,c -replicas 50 -hash fnv64 -add d -remove b
+func runRing(args []string) error {
+	fs := flag.NewFlagSet("ring", flag.ExitOnError)
+	peers := fs.String("peers", "http://localhost:8081,http://localhost:8082,http://localhost:8083",
+		"Peers separated by commas, a peer may have a weight as peer=weight")
+	replicas := fs.Int("replicas", 50, "Virtual nodes of a peer of weight 1")
+	hash := fs.String("hash", "crc32", "Hash of the ring: crc32, fnv64 or seeded, with the seed in MYCACHE_SEED")
+	add := fs.String("add", "", "Peer to simulate adding, as peer=weight or peer")
+	remove := fs.String("remove", "", "Peer to simulate removing")
+	keys := fs.Int("keys", 100000, "Sample keys to count the moved ones")
+	fs.Parse(args)
+
+	weights, err := parsePeers(*peers)
+	if err != nil {
+		return err
+	}
+	var addWeights map[string]int
+	if *add != "" {
+		if addWeights, err = parsePeers(*add); err != nil {
+			return err
+		}
+		for peer := range addWeights {
+			// adding a peer again only changes its weight
+			if _, ok := weights[peer]; ok {
+				return fmt.Errorf("peer %s to add is in the ring already", peer)
+			}
+		}
+	}
+	newRing := func() (*consistent.Map, error) {
+		var m *consistent.Map
+		switch *hash {
+		case "crc32":
+			m = consistent.New(*replicas, nil)
+		case "fnv64":
+			m = consistent.New64(*replicas, nil)
+		case "seeded":
+			seed := os.Getenv("MYCACHE_SEED")
+			if seed == "" {
+				return nil, fmt.Errorf("seeded hash needs MYCACHE_SEED")
+			}
+			m = consistent.New64(*replicas, consistent.SeededHash64([]byte(seed)))
+		default:
+			return nil, fmt.Errorf("unknown hash %s", *hash)
+		}
+		for peer, weight := range weights {
+			m.AddWeighted(peer, weight)
+		}
+		return m, nil
+	}
+
+	m, err := newRing()
+	if err != nil {
+		return err
+	}
+	reportShares(os.Stdout, m, weights)
+
+	if *add != "" {
+		added, err := newRing()
+		if err != nil {
+			return err
+		}
+		addTotal := 0
+		for peer, weight := range addWeights {
+			added.AddWeighted(peer, weight)
+			addTotal += weight
+		}
+		ideal := float64(addTotal) / float64(total(weights)+addTotal)
+		fmt.Printf("\nadding %s moves %.4f of keys, ideally %.4f\n", *add, movedKeys(m, added, *keys), ideal)
+	}
+	if *remove != "" {
+		if !m.Has(*remove) {
+			return fmt.Errorf("no such peer %s to remove", *remove)
+		}
+		removed, err := newRing()
+		if err != nil {
+			return err
+		}
+		removed.Remove(*remove)
+		ideal := float64(weights[*remove]) / float64(total(weights))
+		fmt.Printf("\nremoving %s moves %.4f of keys, ideally %.4f\n", *remove, movedKeys(m, removed, *keys), ideal)
+	}
+	return nil
+}
+
+// parsePeers parses peers as peer=weight, a peer without a weight has 1
+func parsePeers(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, peer := range strings.Split(s, ",") {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		weight := 1
+		if i := strings.LastIndexByte(peer, '='); i >= 0 {
+			w, err := strconv.Atoi(peer[i+1:])
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("bad weight of peer %s", peer)
+			}
+			peer, weight = peer[:i], w
+		}
+		weights[peer] = weight
+	}
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("no peers")
+	}
+	return weights, nil
+}
+
+// reportShares writes the share of each peer in m, against the share
+// expected by its weight, and the standard deviation of the differences
+func reportShares(w io.Writer, m *consistent.Map, weights map[string]int) {
+	all := total(weights)
+	shares := m.Shares()
+	nodes := m.Nodes()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "peer\tweight\tshare\texpected\tdiff")
+	var squares float64
+	for _, node := range nodes {
+		expected := float64(weights[node]) / float64(all)
+		diff := shares[node] - expected
+		squares += diff * diff
+		fmt.Fprintf(tw, "%s\t%d\t%.4f\t%.4f\t%+.4f\n", node, weights[node], shares[node], expected, diff)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nstddev of shares from expected: %.4f\n", math.Sqrt(squares/float64(len(nodes))))
+}
+
+// total returns the sum of weights
+func total(weights map[string]int) int {
+	sum := 0
+	for _, weight := range weights {
+		sum += weight
+	}
+	return sum
+}
+
+// movedKeys returns the fraction of n sample keys placed on
+// different peers by before and after
+func movedKeys(before, after *consistent.Map, n int) float64 {
+	moved := 0
+	for i := 0; i < n; i++ {
+		k := "key" + strconv.Itoa(i)
+		if before.Locate(k) != after.Locate(k) {
+			moved++
+		}
+	}
+	return float64(moved) / float64(n)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github/mycache/consistent"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParsePeers(t *testing.T) {
+	weights, err := parsePeers("a=4, b,,c=1")
+	if expect := map[string]int{"a": 4, "b": 1, "c": 1}; err != nil || !reflect.DeepEqual(weights, expect) {
+		t.Fatalf("should parse %v, got %v %v", expect, weights, err)
+	}
+	// the weight is after the last =
+	if weights, err := parsePeers("http://a?x=1=2"); err != nil || weights["http://a?x=1"] != 2 {
+		t.Fatalf("should parse weight 2, got %v %v", weights, err)
+	}
+	for _, s := range []string{"", " , ", "a=0", "a=-1", "a=x"} {
+		if _, err := parsePeers(s); err == nil {
+			t.Errorf("%q should fail to parse", s)
+		}
+	}
+}
+
+func TestMovedKeys(t *testing.T) {
+	before := consistent.New(50, nil)
+	after := consistent.New(50, nil)
+	for _, peer := range []string{"a", "b", "c"} {
+		before.AddWeighted(peer, 1)
+		after.AddWeighted(peer, 1)
+	}
+	if moved := movedKeys(before, after, 1000); moved != 0 {
+		t.Fatalf("same rings should move no keys, got %.4f", moved)
+	}
+	after.Remove("c")
+	if moved := movedKeys(before, after, 1000); moved != float64(countOn(before, "c", 1000))/1000 {
+		t.Fatalf("only the keys of c should move, got %.4f", moved)
+	}
+}
+
+// countOn returns how many of n sample keys m places on peer
+func countOn(m *consistent.Map, peer string, n int) int {
+	count := 0
+	for i := 0; i < n; i++ {
+		if m.Locate("key"+strconv.Itoa(i)) == peer {
+			count++
+		}
+	}
+	return count
+}
@@ -1,43 +1,209 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
 
-type call struct {
+// ErrGoexit is returned to the callers waiting for a callback,
+// which calls runtime.Goexit
+var ErrGoexit = errors.New("singleflight: callback called runtime.Goexit")
+
+// PanicError is returned to every caller of a callback that panics.
+// Error leaves out the stack, the message may be sent to clients.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack where the panic happens
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: callback panicked: %v", p.Value)
+}
+
+type call[V any] struct {
 	wg  sync.WaitGroup // avoid reentrance
-	val interface{}    // the query result
+	val V              // the query result
 	err error
+
+	dups  int                // callers sharing the result
+	chans []chan<- Result[V] // callers of DoChan waiting for the result
+	done  bool               // the result is kept for the dedupe window
+
+	shared bool // the leader's result is shared, when it completes
+}
+
+// Result holds the result of a callback, for DoChan
+type Result[V any] struct {
+	Val    V
+	Err    error
+	Shared bool // whether the result is given to more than one caller
 }
 
 // Group is a singleflight shared in a cache group,
-// makes sure that each key is fetched once
-type Group struct {
-	mu     sync.Mutex       // protect resMap
-	resMap map[string]*call // store query result
+// makes sure that each key is fetched once.
+// The zero value is ready to use.
+type Group[K comparable, V any] struct {
+	mu     sync.Mutex     // protect resMap
+	resMap map[K]*call[V] // store query result
+	window time.Duration  // how long a completed result is kept
+	keep   func(err error) bool
+}
+
+// SetWindow keeps each completed result for d, callers in the window
+// share it instead of invoking the callback again. Errors are kept as
+// well, but not panics, context errors or the ones SetKeep rejects.
+// Zero turns it off.
+func (g *Group[K, V]) SetWindow(d time.Duration) {
+	g.mu.Lock()
+	g.window = d
+	g.mu.Unlock()
+}
+
+// SetKeep sets which errors are kept for the window, in addition
+// to context errors which never are. An error of one caller, e.g.
+// shedding its load, shouldn't be given to the others.
+func (g *Group[K, V]) SetKeep(keep func(err error) bool) {
+	g.mu.Lock()
+	g.keep = keep
+	g.mu.Unlock()
+}
+
+// kept tells whether a completed result of err is kept. g.mu must be held.
+func (g *Group[K, V]) kept(err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return g.keep == nil || g.keep(err)
 }
 
 // Do invokes the callback that binds to key, and stores
-// the result as a call for sharing.
-func (g *Group) Do(key string, callback func() (interface{}, error)) (interface{}, error) {
+// the result as a call for sharing. If the callback panics or
+// calls runtime.Goexit, the callers get a *PanicError or ErrGoexit,
+// and the next call of key invokes the callback again.
+// shared tells whether v is given to more than one caller.
+func (g *Group[K, V]) Do(key K, callback func() (V, error)) (v V, err error, shared bool) {
 	g.mu.Lock()
 	if g.resMap == nil {
-		g.resMap = make(map[string]*call)
+		g.resMap = make(map[K]*call[V])
 	}
 	if c, ok := g.resMap[key]; ok { // reuse the result
+		c.dups++
 		g.mu.Unlock()
 		c.wg.Wait()
-		return c.val, c.err
+		return c.val, c.err, true
+	}
+	c := new(call[V])
+	c.wg.Add(1)
+	g.resMap[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, callback)
+	return c.val, c.err, c.shared
+}
+
+// DoChan is like Do, but returns a channel that receives
+// the result when it's ready, the callback runs in a new goroutine
+// if there's no call of key in flight
+func (g *Group[K, V]) DoChan(key K, callback func() (V, error)) <-chan Result[V] {
+	ch := make(chan Result[V], 1)
+	g.mu.Lock()
+	if g.resMap == nil {
+		g.resMap = make(map[K]*call[V])
+	}
+	if c, ok := g.resMap[key]; ok {
+		c.dups++
+		if c.done {
+			ch <- Result[V]{Val: c.val, Err: c.err, Shared: true}
+		} else {
+			c.chans = append(c.chans, ch)
+		}
+		g.mu.Unlock()
+		return ch
 	}
-	c := new(call)
+	c := &call[V]{chans: []chan<- Result[V]{ch}}
 	c.wg.Add(1)
 	g.resMap[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = callback()
-	c.wg.Done()
+	go g.doCall(c, key, callback)
+	return ch
+}
 
+// DoContext is like Do, but returns ctx's error once ctx is done,
+// the callback goes on for the other callers of key
+func (g *Group[K, V]) DoContext(ctx context.Context, key K, callback func() (V, error)) (v V, err error, shared bool) {
+	if ctx.Done() == nil { // never canceled
+		return g.Do(key, callback)
+	}
+	select {
+	case res := <-g.DoChan(key, callback):
+		return res.Val, res.Err, res.Shared
+	case <-ctx.Done():
+		return v, ctx.Err(), false
+	}
+}
+
+// Forget forgets the call of key in flight, so the next call
+// of key invokes the callback again instead of waiting for it
+func (g *Group[K, V]) Forget(key K) {
 	g.mu.Lock()
 	delete(g.resMap, key)
 	g.mu.Unlock()
+}
+
+// doCall invokes the callback, the waiters are always released
+// and key is removed, even if the callback panics or exits
+func (g *Group[K, V]) doCall(c *call[V], key K, callback func() (V, error)) {
+	returned, recovered := false, false
+	defer func() {
+		if !returned { // runtime.Goexit unwinds through here
+			var zero V
+			c.val, c.err = zero, ErrGoexit
+		}
+		c.wg.Done()
+
+		g.mu.Lock()
+		if g.resMap[key] == c { // may be forgotten and called again
+			if g.window > 0 && returned && !recovered && g.kept(c.err) {
+				c.done = true
+				time.AfterFunc(g.window, func() { g.expire(key, c) })
+			} else {
+				delete(g.resMap, key)
+			}
+		}
+		c.shared = c.dups > 0
+		res := Result[V]{Val: c.val, Err: c.err, Shared: c.shared}
+		for _, ch := range c.chans {
+			ch <- res
+		}
+		g.mu.Unlock()
+	}()
 
-	return c.val, c.err
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				recovered = true
+				var zero V
+				c.val, c.err = zero, &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		c.val, c.err = callback()
+	}()
+	returned = true
+}
+
+// expire removes the result of c after the dedupe window
+func (g *Group[K, V]) expire(key K, c *call[V]) {
+	g.mu.Lock()
+	if g.resMap[key] == c {
+		delete(g.resMap, key)
+	}
+	g.mu.Unlock()
 }
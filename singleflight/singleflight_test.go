@@ -0,0 +1,198 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group[string, string]
+	v, err, shared := g.Do("key", func() (string, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v", v, err, shared)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var g Group[string, string]
+	start := make(chan struct{})
+	errs := make(chan error, 2)
+
+	go func() {
+		_, err, _ := g.Do("key", func() (string, error) {
+			<-start
+			panic("boom")
+		})
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		_, err, _ := g.Do("key", func() (string, error) {
+			return "", nil
+		})
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(start)
+
+	for i := 0; i < 2; i++ {
+		var pe *PanicError
+		if err := <-errs; !errors.As(err, &pe) || pe.Value != "boom" {
+			t.Fatalf("every caller should get the panic, got %v", err)
+		}
+		if len(pe.Stack) == 0 || pe.Error() != "singleflight: callback panicked: boom" {
+			t.Fatalf("stack should be kept out of the message, got %q", pe.Error())
+		}
+	}
+
+	// key is cleaned up, the next call runs again
+	if v, err, _ := g.Do("key", func() (string, error) {
+		return "bar", nil
+	}); v != "bar" || err != nil {
+		t.Fatalf("Do after panic = %v, %v", v, err)
+	}
+}
+
+func TestGoexit(t *testing.T) {
+	var g Group[string, string]
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Do("key", func() (string, error) {
+			<-start
+			runtime.Goexit()
+			return "", nil
+		})
+		t.Errorf("leader should exit")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		_, err, _ := g.Do("key", func() (string, error) {
+			return "", nil
+		})
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(start)
+
+	if err := <-done; err != ErrGoexit {
+		t.Fatalf("waiter should get ErrGoexit, got %v", err)
+	}
+	wg.Wait()
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group[string, string]
+	release := make(chan struct{})
+	fn := func() (string, error) {
+		<-release
+		return "bar", nil
+	}
+	ch1 := g.DoChan("key", fn)
+	ch2 := g.DoChan("key", fn)
+	close(release)
+
+	for _, ch := range []<-chan Result[string]{ch1, ch2} {
+		if res := <-ch; res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("DoChan = %+v", res)
+		}
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group[string, string]
+	release := make(chan struct{})
+	fn := func() (string, error) {
+		<-release
+		return "bar", nil
+	}
+	ch := g.DoChan("key", fn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "key", fn); err != context.DeadlineExceeded {
+		t.Fatalf("DoContext should return on cancellation, got %v", err)
+	}
+
+	// the load goes on for the others
+	close(release)
+	if res := <-ch; res.Val != "bar" || res.Err != nil {
+		t.Fatalf("DoChan = %+v", res)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group[string, string]
+	release := make(chan struct{})
+	ch := g.DoChan("key", func() (string, error) {
+		<-release
+		return "old", nil
+	})
+	g.Forget("key")
+
+	// a fresh load instead of waiting for the forgotten one
+	v, _, shared := g.Do("key", func() (string, error) {
+		return "new", nil
+	})
+	if v != "new" || shared {
+		t.Fatalf("Do after Forget = %v, %v", v, shared)
+	}
+	close(release)
+	if res := <-ch; res.Val != "old" {
+		t.Fatalf("forgotten load should still finish, got %+v", res)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var g Group[string, string]
+	g.SetWindow(20 * time.Millisecond)
+	calls := 0
+	fn := func() (string, error) {
+		calls++
+		return "", errors.New("db is down")
+	}
+
+	g.Do("key", fn)
+	if _, err, shared := g.Do("key", fn); err == nil || !shared || calls != 1 {
+		t.Fatalf("error should be shared in window, got %v %v with %d calls", err, shared, calls)
+	}
+	if res := <-g.DoChan("key", fn); res.Err == nil || calls != 1 {
+		t.Fatalf("DoChan should get the kept result, got %+v with %d calls", res, calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g.Do("key", fn)
+	if calls != 2 {
+		t.Fatalf("result should be removed after window, got %d calls", calls)
+	}
+}
+
+func TestWindowKeep(t *testing.T) {
+	var g Group[string, string]
+	g.SetWindow(time.Minute)
+	errBusy := errors.New("busy")
+	g.SetKeep(func(err error) bool { return err != errBusy })
+
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded, errBusy} {
+		calls := 0
+		fn := func() (string, error) {
+			calls++
+			return "", err
+		}
+		g.Do("key", fn)
+		g.Do("key", fn)
+		if calls != 2 {
+			t.Fatalf("%v should not be kept, got %d calls", err, calls)
+		}
+	}
+}